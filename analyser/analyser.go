@@ -2,165 +2,86 @@ package analyser
 
 import (
 	"context"
-	"math"
-	"strings"
-	"time"
+	"errors"
+	"math/big"
 
 	"github.com/monetha/ico-analyzer/types"
 )
 
-// Run will run the analyser
-func Run(ctx context.Context, data *types.ICOPassport) (analysedData types.CalculatedData, icoRatingData types.ICORatingData, err error) {
-	if data.Metadata.Version != 0 {
-		icoRatingData = data.IcoInfo
-		analysedData = data.CalculatedData
-
-		timeLayout := "02 Jan 2006"
-		icoStartDate, err := time.Parse(timeLayout, data.IcoInfo.IcoStartDate)
-		if err != nil {
-			return analysedData, icoRatingData, err
-		}
-
-		icoEndDate, err := time.Parse(timeLayout, data.IcoInfo.IcoEndDate)
-		if err != nil {
-			return analysedData, icoRatingData, err
-		}
-		startDateEthRate, endDateEthRate, err := getEthRateFromPoloneix(icoStartDate.Unix(), icoEndDate.Unix())
-		if err != nil {
-			return analysedData, icoRatingData, err
-		}
-		icoRatingData.IcoPriceAdjusted = icoRatingData.IcoPrice * (endDateEthRate / startDateEthRate)
-		analysedData.EthRateStart = startDateEthRate
-		analysedData.EthRateEnd = endDateEthRate
-		ethPriceFluctuation := math.Abs((endDateEthRate - startDateEthRate) / startDateEthRate)
-		analysedData.EfrToken = float64(analysedData.TokensIssued) * icoRatingData.IcoPrice
-		analysedData.EfrTokenAdjusted = float64(analysedData.TokensIssued) * icoRatingData.IcoPriceAdjusted
-		analysedData.TokenCheckResult.FundsRaisedDiff = (analysedData.EfrToken - icoRatingData.Cfr) / icoRatingData.Cfr
-		analysedData.TokenCheckResult.FundsRaisedAdjustedDiff = (analysedData.EfrTokenAdjusted - icoRatingData.Cfr) / icoRatingData.Cfr
-
-		ethPriceFluctuation = math.Max(ethPriceFluctuation, data.Metadata.Confidence)
-		analysedData.TokenCheckResult.FundsRaisedCheck = "Passed"
-		if analysedData.TokenCheckResult.FundsRaisedDiff < 0 && (math.Abs(analysedData.TokenCheckResult.FundsRaisedDiff) > ethPriceFluctuation) {
-			analysedData.TokenCheckResult.FundsRaisedCheck = "Failed"
-		}
-
-		data.Metadata.FundAddress = data.Metadata.OwnerAddress
-		data.Metadata.OwnerIsIcoWallet = true
-		if data.Metadata.CrowdSaleAddress != "" && data.Metadata.OwnerAddress != data.Metadata.CrowdSaleAddress {
-			data.Metadata.FundAddress = data.Metadata.CrowdSaleAddress
-			data.Metadata.OwnerIsIcoWallet = false
-			var crowdSaleBalance float64
-			var txnCount int64
-			var ethBalance float64
-			var fundAddress string
-
-			crowdSaleBalance, txnCount, err = getCrowdSaleBalance(strings.ToLower(data.Metadata.FundAddress))
-			if err != nil {
-				return analysedData, icoRatingData, err
-			}
-
-			fundAddress, ethBalance, err = getEthBalance(strings.ToLower(data.Metadata.FundAddress))
-			if err != nil {
-				return analysedData, icoRatingData, err
-			}
-
-			endDateEthRate = math.Max(endDateEthRate, startDateEthRate)
-			data.Metadata.FundAddress = fundAddress
-			analysedData.Metrics.FundsBalanceEth = ethBalance
-			analysedData.IcoEthIn = crowdSaleBalance
-			analysedData.IcoEthOut = 0
-			analysedData.IcoEthTotal = txnCount
-			analysedData.EfrIcoTx = crowdSaleBalance * endDateEthRate
-		}
-
-		analysedData.EfrOwnerTxCurrency = icoRatingData.CfrCurrency
-		analysedData.IcoWalletCheckResult.FundsRaisedDiff = (analysedData.EfrIcoTx - float64(icoRatingData.Cfr)) / float64(icoRatingData.Cfr)
-		analysedData.IcoWalletCheckResult.FundsRaisedCheck = "Passed"
+const (
+	secondsPerDay = 24 * 60 * 60
+	// weiDecimals is number of decimals of ETH amounts in wei
+	weiDecimals = 18
+)
 
-		if analysedData.IcoWalletCheckResult.FundsRaisedDiff < 0 && (math.Abs(analysedData.IcoWalletCheckResult.FundsRaisedDiff) > ethPriceFluctuation) {
-			analysedData.IcoWalletCheckResult.FundsRaisedCheck = "Failed"
-		}
+// Analyser analyses ICO using the given data sources
+type Analyser struct {
+	ICOInfo  ICOInfoSource
+	Explorer ChainExplorer
+	Prices   PriceOracle
+	// Exchanges are known exchange addresses (lower case) with labels used by outflow tracing, DefaultExchanges are used when nil
+	Exchanges map[string]string
+	// Tokens reads ERC20 token metadata, Explorer is used when it implements TokenMetadataReader and Tokens is nil
+	Tokens TokenMetadataReader
+	// ScoreWeights are weights of trust score factors, DefaultScoreWeights are used when nil
+	ScoreWeights *ScoreWeights
+	// Currencies converts ICO prices and funds raised to ReportingCurrency, only USD and ETH amounts are supported when nil
+	Currencies CurrencyConverter
+}
 
-		analysedData.Metrics.DistributionDays = icoEndDate.Sub(icoStartDate).Hours() / 24
-		analysedData.Metrics.DistributionStartFromIcoStart = data.CalculatedData.Metrics.DistributionStartFromIcoStart
-		analysedData.Metrics.DistributionEndFromIcoEnd = data.CalculatedData.Metrics.DistributionEndFromIcoEnd
-		return analysedData, icoRatingData, nil
+// New creates an analyser which uses the given data sources
+func New(icoInfo ICOInfoSource, explorer ChainExplorer, prices PriceOracle) *Analyser {
+	return &Analyser{
+		ICOInfo:  icoInfo,
+		Explorer: explorer,
+		Prices:   prices,
 	}
+}
 
-	icoRatingData, icoStartDate, icoEndDate, err := icoRating(data.Metadata.IcoName)
-	if err != nil {
-		return analysedData, icoRatingData, err
-	}
+// NewDefault creates an analyser which uses icorating.com, etherscan.io, poloniex.com and CoinGecko
+func NewDefault() *Analyser {
+	a := New(NewICORating(), NewEtherScan(), NewPoloniex())
+	a.Currencies = NewCoinGeckoRates()
+	return a
+}
 
-	totalSupply, tokenIssuingAddress, tokenStartDate, tokenEndDate, err := getTokenCount(strings.ToLower(data.Metadata.TokenContractAddress), data.Metadata.Decimals, icoEndDate)
-	if err != nil {
-		return analysedData, icoRatingData, err
-	}
-	data.Metadata.TokenIssuerAddress = tokenIssuingAddress
-	data.Metadata.Confidence = 0.1
+// Run will run the analyser with default data sources
+func Run(ctx context.Context, data *types.ICOPassport) (analysedData types.CalculatedData, icoRatingData types.ICORatingData, err error) {
+	return NewDefault().Run(ctx, data)
+}
 
-	startDateEthRate, endDateEthRate, err := getEthRateFromPoloneix(icoStartDate.Unix(), icoEndDate.Unix())
-	if err != nil {
-		return analysedData, icoRatingData, err
-	}
-	icoRatingData.IcoPriceAdjusted = icoRatingData.IcoPrice * (endDateEthRate / startDateEthRate)
-	analysedData.EthRateStart = startDateEthRate
-	analysedData.EthRateEnd = endDateEthRate
-	ethPriceFluctuation := math.Abs((endDateEthRate - startDateEthRate) / startDateEthRate)
-	analysedData.TokensIssued = int64(totalSupply)
-	analysedData.EfrToken = float64(analysedData.TokensIssued) * icoRatingData.IcoPrice
-	analysedData.EfrTokenAdjusted = float64(analysedData.TokensIssued) * icoRatingData.IcoPriceAdjusted
-	analysedData.TokenCheckResult.FundsRaisedDiff = (analysedData.EfrToken - icoRatingData.Cfr) / icoRatingData.Cfr
-	analysedData.TokenCheckResult.FundsRaisedAdjustedDiff = (analysedData.EfrTokenAdjusted - icoRatingData.Cfr) / icoRatingData.Cfr
+// Run will run the analyser, stages whose data is supplied by the passport are skipped
+func (a *Analyser) Run(ctx context.Context, data *types.ICOPassport) (analysedData types.CalculatedData, icoRatingData types.ICORatingData, err error) {
+	return a.RunStages(ctx, data, Options{})
+}
 
-	ethPriceFluctuation = math.Max(ethPriceFluctuation, data.Metadata.Confidence)
-	analysedData.TokenCheckResult.FundsRaisedCheck = "Passed"
-	if analysedData.TokenCheckResult.FundsRaisedDiff < 0 && (math.Abs(analysedData.TokenCheckResult.FundsRaisedDiff) > ethPriceFluctuation) {
-		analysedData.TokenCheckResult.FundsRaisedCheck = "Failed"
+// crowdSale returns wei received by the crowdsale address, contributions are listed when the chain explorer supports it
+func (a *Analyser) crowdSale(ctx context.Context, address string) (balance *big.Int, txnCount int64, contributions []Contribution, err error) {
+	if lister, ok := a.Explorer.(ContributionLister); ok {
+		contributions, err = lister.CrowdSaleContributions(ctx, address)
+		if err != errNotSupported {
+			balance, txnCount = sumContributions(contributions)
+			return
+		}
 	}
 
-	data.Metadata.FundAddress = data.Metadata.OwnerAddress
-	data.Metadata.OwnerIsIcoWallet = true
-	if data.Metadata.CrowdSaleAddress != "" && data.Metadata.OwnerAddress != data.Metadata.CrowdSaleAddress {
-		data.Metadata.FundAddress = data.Metadata.CrowdSaleAddress
-		data.Metadata.OwnerIsIcoWallet = false
-	}
-	data.Metadata.EthNominated = true
-	data.Metadata.TokenTxInputAdjustment = false
-	var crowdSaleBalance float64
-	var ethBalance float64
-	var txnCount int64
-	var fundAddress string
+	balance, txnCount, err = a.Explorer.CrowdSaleBalance(ctx, address)
+	return
+}
 
-	if data.Metadata.FundAddress != "" {
-		crowdSaleBalance, txnCount, err = getCrowdSaleBalance(strings.ToLower(data.Metadata.FundAddress))
-		if err != nil {
-			return analysedData, icoRatingData, err
-		}
+// timeWeightedEfr values every contribution at ETH/USD rate of its own time taken from the rates series
+// quoted for the ICO period, contributions outside the period are valued at the nearest rate of the series
+func timeWeightedEfr(series []RatePoint, contributions []Contribution) (efr float64, err error) {
+	if len(contributions) == 0 {
+		return
 	}
-
-	fundAddress, ethBalance, err = getEthBalance(strings.ToLower(data.Metadata.FundAddress))
-	if err != nil {
-		return analysedData, icoRatingData, err
+	if len(series) == 0 {
+		err = errors.New("ETH rates series of the ICO period is not available")
+		return
 	}
-	data.Metadata.FundAddress = fundAddress
-	analysedData.Metrics.FundsBalanceEth = ethBalance
 
-	endDateEthRate = math.Max(endDateEthRate, startDateEthRate)
-	analysedData.IcoEthIn = crowdSaleBalance
-	analysedData.IcoEthOut = 0
-	analysedData.IcoEthTotal = txnCount
-	analysedData.EfrIcoTx = crowdSaleBalance * endDateEthRate
-	analysedData.EfrOwnerTxCurrency = icoRatingData.CfrCurrency
-	analysedData.IcoWalletCheckResult.FundsRaisedDiff = (analysedData.EfrIcoTx - float64(icoRatingData.Cfr)) / float64(icoRatingData.Cfr)
-	analysedData.IcoWalletCheckResult.FundsRaisedCheck = "Passed"
-
-	if analysedData.IcoWalletCheckResult.FundsRaisedDiff < 0 && (math.Abs(analysedData.IcoWalletCheckResult.FundsRaisedDiff) > ethPriceFluctuation) {
-		analysedData.IcoWalletCheckResult.FundsRaisedCheck = "Failed"
+	for _, c := range contributions {
+		efr += types.NewAmount(c.Value, weiDecimals).Float64() * rateAt(series, c.Time)
 	}
-
-	analysedData.Metrics.DistributionDays = icoEndDate.Sub(icoStartDate).Hours() / 24
-	analysedData.Metrics.DistributionStartFromIcoStart = tokenStartDate
-	analysedData.Metrics.DistributionEndFromIcoEnd = tokenEndDate
-	return analysedData, icoRatingData, nil
+	return
 }
@@ -0,0 +1,52 @@
+package analyser
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// ratio returns a / b, ok is false when the result is not a finite number, e.g. b is zero
+func ratio(a, b float64) (r float64, ok bool) {
+	r = a / b
+	if math.IsNaN(r) || math.IsInf(r, 0) {
+		return 0, false
+	}
+	return r, true
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// fundsRaisedCheck compares funds raised derived from on-chain data with claimed funds raised,
+// the check fails when funds raised are lower than claimed by more than maxShortfall
+func fundsRaisedCheck(efr, cfr, maxShortfall float64) (result types.FundsRaisedResult) {
+	result.FundsRaisedCheck = types.CheckInconclusive
+	if !isFinite(maxShortfall) {
+		result.Reason = "ETH rate change over ICO period is not known"
+		return
+	}
+	result.MaxShortfall = maxShortfall
+
+	if !isFinite(efr) {
+		result.Reason = "funds raised derived from on-chain data are not known"
+		return
+	}
+	diff, ok := ratio(efr-cfr, cfr)
+	if !ok || cfr < 0 {
+		result.Reason = "claimed funds raised are not known"
+		return
+	}
+	result.FundsRaisedDiff = diff
+
+	if diff < 0 && math.Abs(diff) > maxShortfall {
+		result.FundsRaisedCheck = types.CheckFailed
+		result.Reason = fmt.Sprintf("funds raised are lower than claimed by %.1f%%, allowed shortfall is %.1f%%", -diff*100, maxShortfall*100)
+		return
+	}
+	result.FundsRaisedCheck = types.CheckPassed
+	result.Reason = fmt.Sprintf("funds raised differ from claimed by %+.1f%%, allowed shortfall is %.1f%%", diff*100, maxShortfall*100)
+	return
+}
@@ -0,0 +1,70 @@
+package analyser
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+func TestRatio(t *testing.T) {
+	tests := []struct {
+		a, b   float64
+		want   float64
+		wantOk bool
+	}{
+		{1, 2, 0.5, true},
+		{-1, 4, -0.25, true},
+		{0, 5, 0, true},
+		{1, 0, 0, false},
+		{-1, 0, 0, false},
+		{0, 0, 0, false},
+		{math.Inf(1), 1, 0, false},
+		{math.NaN(), 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ratio(tt.a, tt.b)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("ratio(%v, %v) returned %v, %v, want %v, %v", tt.a, tt.b, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestFundsRaisedCheck(t *testing.T) {
+	tests := []struct {
+		name              string
+		efr, cfr, max     float64
+		want              types.CheckStatus
+		wantDiff, wantMax float64
+	}{
+		{"equal", 100, 100, 0.1, types.CheckPassed, 0, 0.1},
+		{"above claimed", 150, 100, 0.1, types.CheckPassed, 0.5, 0.1},
+		{"shortfall at the limit", 90, 100, 0.1, types.CheckPassed, -0.1, 0.1},
+		{"shortfall above the limit", 89, 100, 0.1, types.CheckFailed, -0.11, 0.1},
+		{"nothing raised", 0, 100, 0.1, types.CheckFailed, -1, 0.1},
+		{"zero claimed", 100, 0, 0.1, types.CheckInconclusive, 0, 0.1},
+		{"nothing raised nor claimed", 0, 0, 0.1, types.CheckInconclusive, 0, 0.1},
+		{"negative claimed", 100, -100, 0.1, types.CheckInconclusive, 0, 0.1},
+		{"unknown funds raised", math.NaN(), 100, 0.1, types.CheckInconclusive, 0, 0.1},
+		{"infinite funds raised", math.Inf(1), 100, 0.1, types.CheckInconclusive, 0, 0.1},
+		{"unknown rate change", 100, 100, math.NaN(), types.CheckInconclusive, 0, 0},
+		{"infinite rate change", 100, 100, math.Inf(1), types.CheckInconclusive, 0, 0},
+	}
+
+	for _, tt := range tests {
+		result := fundsRaisedCheck(tt.efr, tt.cfr, tt.max)
+		if result.FundsRaisedCheck != tt.want || result.Reason == "" {
+			t.Errorf("%s: fundsRaisedCheck returned %+v, want %s", tt.name, result, tt.want)
+		}
+		if !closeTo(result.FundsRaisedDiff, tt.wantDiff) || result.MaxShortfall != tt.wantMax {
+			t.Errorf("%s: fundsRaisedCheck returned difference %v and shortfall %v, want %v and %v",
+				tt.name, result.FundsRaisedDiff, result.MaxShortfall, tt.wantDiff, tt.wantMax)
+		}
+		// NaN and infinite values can't be written as JSON
+		if _, err := json.Marshal(result); err != nil {
+			t.Errorf("%s: fundsRaisedCheck returned %+v not written as JSON: %v", tt.name, result, err)
+		}
+	}
+}
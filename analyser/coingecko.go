@@ -0,0 +1,101 @@
+package analyser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// CoinGeckoURL is CoinGecko ETH/USD market chart range API, from and to are unix timestamps in seconds
+const CoinGeckoURL = "https://api.coingecko.com/api/v3/coins/ethereum/market_chart/range?vs_currency=usd&from=%d&to=%d"
+
+// CoinGecko fetches ETH/USD rates from CoinGecko market chart history API
+type CoinGecko struct {
+	// Client is HTTP client used for requests, http.DefaultClient is used when nil
+	Client *http.Client
+	// URL is format of market chart range URL with from and to unix timestamps,
+	// any API returning CoinGecko-style "prices" history can be used
+	URL string
+}
+
+// NewCoinGecko creates price oracle backed by CoinGecko API
+func NewCoinGecko() *CoinGecko {
+	return &CoinGecko{URL: CoinGeckoURL}
+}
+
+// Name returns name of the price source
+func (g *CoinGecko) Name() string {
+	return "coingecko"
+}
+
+type coinGeckoMarketChart struct {
+	// Prices is list of [timestamp in milliseconds, price] pairs
+	Prices [][2]float64 `json:"prices"`
+}
+
+// EthRates implements PriceOracle interface
+func (g *CoinGecko) EthRates(ctx context.Context, startDate, endDate int64) (startDateRate, endDateRate float64, err error) {
+	prices, err := g.prices(ctx, startDate, endDate)
+	if err != nil {
+		return
+	}
+
+	startDateRate = prices[0][1]
+	endDateRate = prices[len(prices)-1][1]
+	return
+}
+
+// EthRateSeries implements RateSeriesOracle interface
+func (g *CoinGecko) EthRateSeries(ctx context.Context, startDate, endDate int64) (series []RatePoint, err error) {
+	prices, err := g.prices(ctx, startDate, endDate)
+	if err != nil {
+		return
+	}
+	return priceSeries(prices), nil
+}
+
+// EthRateQuote implements QuotingPriceOracle interface, rates and series come from the same price history
+func (g *CoinGecko) EthRateQuote(ctx context.Context, startDate, endDate int64) (quote EthRateQuote, err error) {
+	prices, err := g.prices(ctx, startDate, endDate)
+	if err != nil {
+		return
+	}
+
+	quote.StartRate = prices[0][1]
+	quote.EndRate = prices[len(prices)-1][1]
+	quote.Source = g.Name()
+	quote.Series = priceSeries(prices)
+	return
+}
+
+func priceSeries(prices [][2]float64) []RatePoint {
+	series := make([]RatePoint, len(prices))
+	for i, price := range prices {
+		series[i] = RatePoint{Time: int64(price[0]) / 1000, Rate: price[1]}
+	}
+	return series
+}
+
+// prices returns [timestamp in milliseconds, price] pairs of the period, at least one pair is returned
+func (g *CoinGecko) prices(ctx context.Context, startDate, endDate int64) (prices [][2]float64, err error) {
+	chartData, err := httpGet(ctx, g.Client, fmt.Sprintf(g.URL, startDate, endDate))
+	if err != nil {
+		return
+	}
+
+	var chart coinGeckoMarketChart
+	err = json.Unmarshal(chartData, &chart)
+	if err != nil {
+		return
+	}
+
+	if len(chart.Prices) == 0 {
+		err = &Error{Reason: ReasonPriceDataMissing, Err: errors.New("no ETH rates returned by coingecko")}
+		return
+	}
+
+	prices = chart.Prices
+	return
+}
@@ -0,0 +1,169 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// capLimit is soft or hard cap of the crowdsale
+type capLimit struct {
+	name     string
+	amount   float64
+	currency string
+}
+
+// crowdSaleCaps returns soft and hard caps, caller-supplied caps take precedence over caps of ICO metadata source
+func crowdSaleCaps(metadata types.ICOAnalyzerData, icoInfo types.ICORatingData) (soft, hard capLimit) {
+	soft = capLimit{name: "soft cap", amount: icoInfo.SoftCap, currency: icoInfo.SoftCapCurrency}
+	if metadata.SoftCap > 0 {
+		soft.amount, soft.currency = metadata.SoftCap, metadata.SoftCapCurrency
+	}
+	hard = capLimit{name: "hard cap", amount: icoInfo.HardCap, currency: icoInfo.HardCapCurrency}
+	if metadata.HardCap > 0 {
+		hard.amount, hard.currency = metadata.HardCap, metadata.HardCapCurrency
+	}
+	return
+}
+
+// capCheck checks that funds raised on-chain are not below the soft cap and not above the hard cap,
+// caps in ETH are compared with ETH received, other caps with the ETH valued in ReportingCurrency within the tolerance
+func (a *Analyser) capCheck(ctx context.Context, metadata types.ICOAnalyzerData, icoInfo types.ICORatingData, analysedData *types.CalculatedData, icoEndDate time.Time, ethRate, tolerance float64) (check types.ComplianceCheck) {
+	check.Result = types.CheckInconclusive
+	soft, hard := crowdSaleCaps(metadata, icoInfo)
+	if soft.amount <= 0 && hard.amount <= 0 {
+		check.Reason = "soft and hard caps are not known"
+		return
+	}
+	if metadata.FundAddress == "" {
+		check.Reason = "fund address is not known"
+		return
+	}
+
+	raisedEth := analysedData.IcoEthIn.Float64()
+	raised := analysedData.EfrIcoTx
+	if analysedData.EfrIcoTxTimeWeighted > 0 {
+		raised = analysedData.EfrIcoTxTimeWeighted
+	}
+
+	check.Thresholds = make(map[string]float64)
+	var compared, failed bool
+	for _, c := range []capLimit{soft, hard} {
+		if c.amount <= 0 {
+			continue
+		}
+
+		value, limit, unit, tol := raised, c.amount, ReportingCurrency, tolerance
+		if normaliseCurrency(c.currency) == "ETH" {
+			value, unit, tol = raisedEth, "ETH", 0
+		} else {
+			if !isFinite(tolerance) || !isFinite(raised) {
+				check.Evidence = append(check.Evidence, fmt.Sprintf("%s %.2f %s can't be compared, ETH rates are not known", c.name, c.amount, c.currency))
+				continue
+			}
+			var err error
+			if limit, err = a.toReportingCurrency(ctx, c.amount, c.currency, icoEndDate, ethRate); err != nil {
+				check.Evidence = append(check.Evidence, fmt.Sprintf("%s %.2f %s can't be converted to %s: %v", c.name, c.amount, c.currency, ReportingCurrency, err))
+				continue
+			}
+		}
+		compared = true
+		check.Thresholds[strings.Replace(c.name, " ", "_", -1)] = limit
+		check.Thresholds["tolerance"] = math.Max(check.Thresholds["tolerance"], tol)
+
+		switch {
+		case c.name == soft.name && value < limit*(1-tol):
+			failed = true
+			check.Evidence = append(check.Evidence, fmt.Sprintf("raised %.2f %s is below %s %.2f %s", value, unit, c.name, limit, unit))
+		case c.name == hard.name && value > limit*(1+tol):
+			failed = true
+			check.Evidence = append(check.Evidence, fmt.Sprintf("raised %.2f %s is above %s %.2f %s", value, unit, c.name, limit, unit))
+		default:
+			check.Evidence = append(check.Evidence, fmt.Sprintf("raised %.2f %s is within %s %.2f %s", value, unit, c.name, limit, unit))
+		}
+	}
+
+	switch {
+	case failed:
+		check.Result, check.Reason = types.CheckFailed, "funds raised on-chain are outside the caps"
+	case compared:
+		check.Result, check.Reason = types.CheckPassed, "funds raised on-chain are within the caps"
+	default:
+		check.Reason = "caps can't be compared with funds raised on-chain"
+	}
+	return
+}
+
+// contributionWindowCheck checks that contributions arrived between ICO start date and the end of ICO end date,
+// txnCount is number of contributions known when they are not listed
+func contributionWindowCheck(contributions []Contribution, txnCount int64, icoStartDate, icoEndDate time.Time) (check types.ComplianceCheck) {
+	check.Result = types.CheckInconclusive
+	if len(contributions) == 0 {
+		check.Reason = "no contributions found"
+		if txnCount > 0 {
+			check.Reason = "contributions are not listed"
+		}
+		return
+	}
+
+	start, end := icoStartDate.Unix(), icoEndDate.Unix()+secondsPerDay
+	check.Thresholds = map[string]float64{"window_start": float64(start), "window_end": float64(end)}
+	var (
+		before, after           int
+		beforeValue, afterValue types.Amount
+	)
+	for _, c := range contributions {
+		switch {
+		case c.Time < start:
+			before++
+			beforeValue = beforeValue.Add(types.NewAmount(c.Value, weiDecimals))
+		case c.Time >= end:
+			after++
+			afterValue = afterValue.Add(types.NewAmount(c.Value, weiDecimals))
+		}
+	}
+
+	check.Result, check.Reason = types.CheckPassed, "contributions arrived within ICO dates"
+	if before > 0 || after > 0 {
+		check.Result, check.Reason = types.CheckFailed, "contributions arrived outside ICO dates"
+	}
+	if before > 0 {
+		check.Evidence = append(check.Evidence, fmt.Sprintf("%d contributions of %s ETH arrived before ICO start date %s", before, beforeValue, icoStartDate.Format(dateLayout)))
+	}
+	if after > 0 {
+		check.Evidence = append(check.Evidence, fmt.Sprintf("%d contributions of %s ETH arrived after ICO end date %s", after, afterValue, icoEndDate.Format(dateLayout)))
+	}
+	if check.Result == types.CheckPassed {
+		check.Evidence = append(check.Evidence, fmt.Sprintf("all %d contributions arrived between %s and %s", len(contributions), icoStartDate.Format(dateLayout), icoEndDate.Format(dateLayout)))
+	}
+	return
+}
+
+// distributionStartCheck checks that the token issuing address didn't distribute tokens before ICO start date
+func distributionStartCheck(tokenStartDate string, icoStartDate time.Time) (check types.ComplianceCheck) {
+	check.Result = types.CheckInconclusive
+	if tokenStartDate == "" {
+		check.Reason = "token distribution start date is not known"
+		return
+	}
+
+	distributionStart, err := time.Parse(dateLayout, tokenStartDate)
+	if err != nil {
+		check.Reason = fmt.Sprintf("token distribution start date %q can't be parsed", tokenStartDate)
+		return
+	}
+	check.Thresholds = map[string]float64{"ico_start": float64(icoStartDate.Unix())}
+
+	check.Result, check.Reason = types.CheckPassed, "token distribution didn't start before ICO"
+	relation := "on or after"
+	if distributionStart.Before(icoStartDate) {
+		check.Result, check.Reason = types.CheckFailed, "token distribution started before ICO"
+		relation = "before"
+	}
+	check.Evidence = append(check.Evidence, fmt.Sprintf("token distribution started on %s, %s ICO start date %s", tokenStartDate, relation, icoStartDate.Format(dateLayout)))
+	return
+}
@@ -0,0 +1,186 @@
+package analyser
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+func TestCapCheck(t *testing.T) {
+	server := newCoinGeckoServer(coinGeckoPrices)
+	defer server.Close()
+
+	const fund = "0x00000000000000000000000000000000000000f0"
+	tests := []struct {
+		name          string
+		metadata      types.ICOAnalyzerData
+		icoInfo       types.ICORatingData
+		raisedEth     int64
+		efr, efrTW    float64
+		tolerance     float64
+		noConverter   bool
+		want          types.CheckStatus
+		wantThreshold map[string]float64
+	}{
+		{
+			name:      "below soft cap",
+			metadata:  types.ICOAnalyzerData{FundAddress: fund},
+			icoInfo:   types.ICORatingData{SoftCap: 1000, SoftCapCurrency: "ETH", HardCap: 10000, HardCapCurrency: "ETH"},
+			raisedEth: 500,
+			want:      types.CheckFailed,
+		},
+		{
+			name:          "within caps",
+			metadata:      types.ICOAnalyzerData{FundAddress: fund},
+			icoInfo:       types.ICORatingData{SoftCap: 100, SoftCapCurrency: "ETH", HardCap: 1000, HardCapCurrency: "eth"},
+			raisedEth:     500,
+			want:          types.CheckPassed,
+			wantThreshold: map[string]float64{"soft_cap": 100, "hard_cap": 1000, "tolerance": 0},
+		},
+		{
+			name:      "caps of request take precedence",
+			metadata:  types.ICOAnalyzerData{FundAddress: fund, SoftCap: 100, SoftCapCurrency: "ETH"},
+			icoInfo:   types.ICORatingData{SoftCap: 1000, SoftCapCurrency: "ETH"},
+			raisedEth: 500,
+			want:      types.CheckPassed,
+		},
+		{
+			name:      "above hard cap",
+			metadata:  types.ICOAnalyzerData{FundAddress: fund},
+			icoInfo:   types.ICORatingData{HardCap: 1000000, HardCapCurrency: "USD"},
+			efr:       1200000,
+			tolerance: 0.1,
+			want:      types.CheckFailed,
+		},
+		{
+			name:      "above hard cap within tolerance",
+			metadata:  types.ICOAnalyzerData{FundAddress: fund},
+			icoInfo:   types.ICORatingData{HardCap: 1000000, HardCapCurrency: "USD"},
+			efr:       1050000,
+			tolerance: 0.1,
+			want:      types.CheckPassed,
+		},
+		{
+			name:      "time-weighted funds raised",
+			metadata:  types.ICOAnalyzerData{FundAddress: fund},
+			icoInfo:   types.ICORatingData{HardCap: 1000000, HardCapCurrency: "USD"},
+			efr:       2000000,
+			efrTW:     900000,
+			tolerance: 0.1,
+			want:      types.CheckPassed,
+		},
+		{
+			name:          "cap in another currency",
+			metadata:      types.ICOAnalyzerData{FundAddress: fund, HardCap: 100, HardCapCurrency: "BTC"},
+			efr:           2000000,
+			tolerance:     0.1,
+			want:          types.CheckFailed,
+			wantThreshold: map[string]float64{"hard_cap": 1000000, "tolerance": 0.1},
+		},
+		{
+			name:        "cap in another currency without converter",
+			metadata:    types.ICOAnalyzerData{FundAddress: fund, HardCap: 100, HardCapCurrency: "BTC"},
+			efr:         2000000,
+			tolerance:   0.1,
+			noConverter: true,
+			want:        types.CheckInconclusive,
+		},
+		{
+			name:      "ETH rates not known",
+			metadata:  types.ICOAnalyzerData{FundAddress: fund},
+			icoInfo:   types.ICORatingData{SoftCap: 1000000, SoftCapCurrency: "USD"},
+			efr:       math.NaN(),
+			tolerance: math.NaN(),
+			want:      types.CheckInconclusive,
+		},
+		{
+			name:      "missing caps",
+			metadata:  types.ICOAnalyzerData{FundAddress: fund},
+			raisedEth: 500,
+			want:      types.CheckInconclusive,
+		},
+		{
+			name:      "missing fund address",
+			icoInfo:   types.ICORatingData{SoftCap: 100, SoftCapCurrency: "ETH"},
+			raisedEth: 500,
+			want:      types.CheckInconclusive,
+		},
+	}
+
+	for _, tt := range tests {
+		a := &Analyser{Currencies: &CoinGeckoRates{URL: server.URL + "/history?date=%s"}}
+		if tt.noConverter {
+			a.Currencies = nil
+		}
+		r := &types.CalculatedData{
+			IcoEthIn:             types.NewAmount(ether(tt.raisedEth), weiDecimals),
+			EfrIcoTx:             tt.efr,
+			EfrIcoTxTimeWeighted: tt.efrTW,
+		}
+
+		check := a.capCheck(context.Background(), tt.metadata, tt.icoInfo, r, icoEnd, 500, tt.tolerance)
+		if check.Result != tt.want || check.Reason == "" {
+			t.Errorf("%s: capCheck returned %+v, want %s", tt.name, check, tt.want)
+		}
+		for name, want := range tt.wantThreshold {
+			if got, ok := check.Thresholds[name]; !ok || !closeTo(got, want) {
+				t.Errorf("%s: capCheck returned thresholds %v, want %s %v", tt.name, check.Thresholds, name, want)
+			}
+		}
+	}
+}
+
+func TestContributionWindowCheck(t *testing.T) {
+	day := int64(secondsPerDay)
+	contribution := func(t int64) Contribution {
+		return Contribution{Time: t, Value: big.NewInt(1e18)}
+	}
+
+	tests := []struct {
+		name          string
+		contributions []Contribution
+		txnCount      int64
+		want          types.CheckStatus
+		wantEvidence  int
+	}{
+		{"within window", []Contribution{contribution(icoStart.Unix()), contribution(icoEnd.Unix() + day - 1)}, 2, types.CheckPassed, 1},
+		{"before start", []Contribution{contribution(icoStart.Unix() - 1), contribution(icoStart.Unix())}, 2, types.CheckFailed, 1},
+		{"after end date", []Contribution{contribution(icoEnd.Unix() + day)}, 1, types.CheckFailed, 1},
+		{"both sides", []Contribution{contribution(icoStart.Unix() - day), contribution(icoEnd.Unix() + 2*day)}, 2, types.CheckFailed, 2},
+		{"no contributions", nil, 0, types.CheckInconclusive, 0},
+		{"contributions not listed", nil, 3, types.CheckInconclusive, 0},
+	}
+
+	for _, tt := range tests {
+		check := contributionWindowCheck(tt.contributions, tt.txnCount, icoStart, icoEnd)
+		if check.Result != tt.want || len(check.Evidence) != tt.wantEvidence {
+			t.Errorf("%s: contributionWindowCheck returned %+v, want %s with %d evidence", tt.name, check, tt.want, tt.wantEvidence)
+		}
+	}
+}
+
+func TestDistributionStartCheck(t *testing.T) {
+	tests := []struct {
+		tokenStartDate string
+		want           types.CheckStatus
+	}{
+		{"01 Mar 2018", types.CheckPassed},
+		{"15 Apr 2018", types.CheckPassed},
+		{"28 Feb 2018", types.CheckFailed},
+		{"", types.CheckInconclusive},
+		{"2018-02-28", types.CheckInconclusive},
+	}
+
+	for _, tt := range tests {
+		check := distributionStartCheck(tt.tokenStartDate, icoStart)
+		if check.Result != tt.want {
+			t.Errorf("distributionStartCheck(%q) returned %+v, want %s", tt.tokenStartDate, check, tt.want)
+		}
+		if tt.want != types.CheckInconclusive && check.Thresholds["ico_start"] != float64(icoStart.Unix()) {
+			t.Errorf("distributionStartCheck(%q) returned thresholds %v, want ICO start %d", tt.tokenStartDate, check.Thresholds, icoStart.Unix())
+		}
+	}
+}
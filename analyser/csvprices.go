@@ -0,0 +1,153 @@
+package analyser
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultCSVMaxGap is the maximum distance between the requested date and the closest rate in CSV file
+const DefaultCSVMaxGap = 48 * time.Hour
+
+// CSVPrices provides ETH/USD rates from a static CSV file,
+// every row holds date (unix timestamp in seconds or YYYY-MM-DD) and ETH/USD rate, header row is optional
+type CSVPrices struct {
+	// MaxGap is the maximum distance between the requested date and the closest rate
+	MaxGap time.Duration
+
+	rates []csvRate
+}
+
+type csvRate struct {
+	Time int64
+	Rate float64
+}
+
+// NewCSVPrices creates price oracle which reads rates from CSV file
+func NewCSVPrices(path string) (*CSVPrices, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadCSVPrices(f)
+}
+
+// ReadCSVPrices creates price oracle which reads rates from CSV data
+func ReadCSVPrices(r io.Reader) (*CSVPrices, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+
+	p := &CSVPrices{MaxGap: DefaultCSVMaxGap}
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := parseCSVTime(record[0])
+		if err != nil {
+			if line == 1 {
+				// header row
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid date %q", line, record[0])
+		}
+
+		rate, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[1])
+		}
+		p.rates = append(p.rates, csvRate{Time: t, Rate: rate})
+	}
+
+	sort.Slice(p.rates, func(i, j int) bool { return p.rates[i].Time < p.rates[j].Time })
+	return p, nil
+}
+
+func parseCSVTime(s string) (int64, error) {
+	if t, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+// Name returns name of the price source
+func (p *CSVPrices) Name() string {
+	return "csv"
+}
+
+// EthRates implements PriceOracle interface
+func (p *CSVPrices) EthRates(ctx context.Context, startDate, endDate int64) (startDateRate, endDateRate float64, err error) {
+	if startDateRate, err = p.rate(startDate); err != nil {
+		return
+	}
+	endDateRate, err = p.rate(endDate)
+	return
+}
+
+// EthRateSeries implements RateSeriesOracle interface
+func (p *CSVPrices) EthRateSeries(ctx context.Context, startDate, endDate int64) (series []RatePoint, err error) {
+	maxGap := int64(p.MaxGap / time.Second)
+	for _, r := range p.rates {
+		if r.Time >= startDate-maxGap && r.Time <= endDate+maxGap {
+			series = append(series, RatePoint{Time: r.Time, Rate: r.Rate})
+		}
+	}
+
+	if len(series) == 0 {
+		err = &Error{Reason: ReasonPriceDataMissing, Err: errors.New("no ETH rates in CSV file for the period")}
+	}
+	return
+}
+
+// EthRateQuote implements QuotingPriceOracle interface
+func (p *CSVPrices) EthRateQuote(ctx context.Context, startDate, endDate int64) (quote EthRateQuote, err error) {
+	if quote.StartRate, quote.EndRate, err = p.EthRates(ctx, startDate, endDate); err != nil {
+		return
+	}
+	quote.Source = p.Name()
+	quote.Series, err = p.EthRateSeries(ctx, startDate, endDate)
+	return
+}
+
+// rate returns rate closest to the date
+func (p *CSVPrices) rate(date int64) (float64, error) {
+	i := sort.Search(len(p.rates), func(i int) bool { return p.rates[i].Time >= date })
+
+	closest := -1
+	if i < len(p.rates) {
+		closest = i
+	}
+	if i > 0 && (closest == -1 || date-p.rates[i-1].Time < p.rates[i].Time-date) {
+		closest = i - 1
+	}
+
+	if closest == -1 || abs64(p.rates[closest].Time-date) > int64(p.MaxGap/time.Second) {
+		return 0, &Error{Reason: ReasonPriceDataMissing, Err: fmt.Errorf("no ETH rate in CSV file near %s", time.Unix(date, 0).UTC().Format(dateLayout))}
+	}
+	return p.rates[closest].Rate, nil
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
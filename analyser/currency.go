@@ -0,0 +1,129 @@
+package analyser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// ReportingCurrency is the currency all funds raised amounts and prices are normalised to
+const ReportingCurrency = "USD"
+
+// CoinGeckoHistoryURL is CoinGecko historical ETH market data API, date is formatted as dd-mm-yyyy
+const CoinGeckoHistoryURL = "https://api.coingecko.com/api/v3/coins/ethereum/history?date=%s&localization=false"
+
+// CurrencyConverter provides exchange rates between currencies
+type CurrencyConverter interface {
+	// Rate returns amount of "to" currency for one unit of "from" currency at the date
+	Rate(ctx context.Context, from, to string, date time.Time) (rate float64, err error)
+}
+
+// normaliseCurrency returns upper case currency code, stablecoins and symbols are replaced with the currency code
+func normaliseCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	switch currency {
+	case "$", "USDT", "US$":
+		return "USD"
+	case "€":
+		return "EUR"
+	}
+	return currency
+}
+
+// CoinGeckoRates converts currencies through ETH prices of CoinGecko history API
+type CoinGeckoRates struct {
+	// Client is HTTP client used for requests, http.DefaultClient is used when nil
+	Client *http.Client
+	// URL is format of CoinGecko-style ETH history URL with dd-mm-yyyy date
+	URL string
+}
+
+// NewCoinGeckoRates creates currency converter backed by CoinGecko API
+func NewCoinGeckoRates() *CoinGeckoRates {
+	return &CoinGeckoRates{URL: CoinGeckoHistoryURL}
+}
+
+type coinGeckoHistory struct {
+	MarketData struct {
+		CurrentPrice map[string]float64 `json:"current_price"`
+	} `json:"market_data"`
+}
+
+// Rate implements CurrencyConverter interface
+func (g *CoinGeckoRates) Rate(ctx context.Context, from, to string, date time.Time) (rate float64, err error) {
+	from, to = normaliseCurrency(from), normaliseCurrency(to)
+	if from == to {
+		return 1, nil
+	}
+
+	historyData, err := httpGet(ctx, g.Client, fmt.Sprintf(g.URL, date.UTC().Format("02-01-2006")))
+	if err != nil {
+		return
+	}
+
+	var history coinGeckoHistory
+	err = json.Unmarshal(historyData, &history)
+	if err != nil {
+		return
+	}
+
+	// ETH price in both currencies gives the cross rate
+	ethPrice := func(currency string) (float64, error) {
+		if currency == "ETH" {
+			return 1, nil
+		}
+		price, ok := history.MarketData.CurrentPrice[strings.ToLower(currency)]
+		if !ok || price <= 0 {
+			return 0, &Error{Reason: ReasonUnsupportedCurrency, Err: fmt.Errorf("no %s rate on %s", currency, date.UTC().Format(dateLayout))}
+		}
+		return price, nil
+	}
+
+	fromPrice, err := ethPrice(from)
+	if err != nil {
+		return
+	}
+	toPrice, err := ethPrice(to)
+	if err != nil {
+		return
+	}
+
+	rate = toPrice / fromPrice
+	return
+}
+
+// toReportingCurrency converts amount in the currency at the date to ReportingCurrency,
+// ETH amounts are converted with ETH/USD rate used by the analysis
+func (a *Analyser) toReportingCurrency(ctx context.Context, amount float64, currency string, date time.Time, ethRate float64) (float64, error) {
+	switch normaliseCurrency(currency) {
+	case ReportingCurrency:
+		return amount, nil
+	case "ETH":
+		return amount * ethRate, nil
+	}
+
+	if a.Currencies == nil {
+		return 0, &Error{Reason: ReasonUnsupportedCurrency, Err: fmt.Errorf("no currency converter for %s", currency)}
+	}
+
+	rate, err := a.Currencies.Rate(ctx, currency, ReportingCurrency, date)
+	if err != nil {
+		return 0, newError(ReasonCurrencyRateUnavailable, err)
+	}
+	return amount * rate, nil
+}
+
+// normaliseICOInfo returns claimed funds raised and ICO price in ReportingCurrency,
+// price is converted at ICO start date and funds raised at ICO end date
+func (a *Analyser) normaliseICOInfo(ctx context.Context, icoInfo types.ICORatingData, icoStartDate, icoEndDate time.Time, startDateEthRate, endDateEthRate float64) (cfr float64, icoPrice float64, err error) {
+	if cfr, err = a.toReportingCurrency(ctx, icoInfo.Cfr, icoInfo.CfrCurrency, icoEndDate, endDateEthRate); err != nil {
+		return
+	}
+	icoPrice, err = a.toReportingCurrency(ctx, icoInfo.IcoPrice, icoInfo.IcoPriceCur, icoStartDate, startDateEthRate)
+	return
+}
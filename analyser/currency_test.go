@@ -0,0 +1,159 @@
+package analyser
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// fixedPrices is price oracle with the same ETH/USD rates of any period
+type fixedPrices struct {
+	start, end float64
+}
+
+func (p fixedPrices) EthRates(ctx context.Context, startDate, endDate int64) (float64, float64, error) {
+	return p.start, p.end, nil
+}
+
+func closeTo(got, want float64) bool {
+	return math.Abs(got-want) <= 1e-9*math.Max(1, math.Abs(want))
+}
+
+// newCoinGeckoServer serves ETH prices of CoinGecko history API by dd-mm-yyyy date
+func newCoinGeckoServer(prices map[string]map[string]float64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		price, ok := prices[r.URL.Query().Get("date")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		var history coinGeckoHistory
+		history.MarketData.CurrentPrice = price
+		json.NewEncoder(w).Encode(history)
+	}))
+}
+
+var (
+	icoStart = time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	icoEnd   = time.Date(2018, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	// ETH prices at ICO start and end dates, 1 BTC is 5000 USD at the start and 10000 USD at the end
+	coinGeckoPrices = map[string]map[string]float64{
+		"01-03-2018": {"usd": 400, "btc": 0.08, "eur": 320},
+		"31-03-2018": {"usd": 500, "btc": 0.05, "eur": 400},
+	}
+)
+
+func TestNormaliseICOInfo(t *testing.T) {
+	server := newCoinGeckoServer(coinGeckoPrices)
+	defer server.Close()
+
+	tests := []struct {
+		name              string
+		icoInfo           types.ICORatingData
+		wantCfr, wantIcoP float64
+		wantReason        Reason
+	}{
+		{
+			name:     "price in ETH, raised in BTC",
+			icoInfo:  types.ICORatingData{IcoPrice: 0.001, IcoPriceCur: "ETH", Cfr: 100, CfrCurrency: "BTC"},
+			wantCfr:  1000000,
+			wantIcoP: 0.4,
+		},
+		{
+			name:     "price in BTC, raised in ETH",
+			icoInfo:  types.ICORatingData{IcoPrice: 0.0001, IcoPriceCur: "btc", Cfr: 2000, CfrCurrency: "eth"},
+			wantCfr:  1000000,
+			wantIcoP: 0.5,
+		},
+		{
+			name:     "USD symbols",
+			icoInfo:  types.ICORatingData{IcoPrice: 0.5, IcoPriceCur: "$", Cfr: 1000000, CfrCurrency: "USDT"},
+			wantCfr:  1000000,
+			wantIcoP: 0.5,
+		},
+		{
+			name:     "EUR",
+			icoInfo:  types.ICORatingData{IcoPrice: 0.32, IcoPriceCur: "EUR", Cfr: 800000, CfrCurrency: "€"},
+			wantCfr:  1000000,
+			wantIcoP: 0.4,
+		},
+		{
+			name:       "unknown currency",
+			icoInfo:    types.ICORatingData{IcoPrice: 1, IcoPriceCur: "USD", Cfr: 1000, CfrCurrency: "XYZ"},
+			wantReason: ReasonUnsupportedCurrency,
+		},
+	}
+
+	a := &Analyser{Currencies: &CoinGeckoRates{URL: server.URL + "/history?date=%s"}}
+	for _, tt := range tests {
+		cfr, icoPrice, err := a.normaliseICOInfo(context.Background(), tt.icoInfo, icoStart, icoEnd, 400, 500)
+		if tt.wantReason != "" {
+			if ReasonOf(err) != tt.wantReason {
+				t.Errorf("%s: normaliseICOInfo returned error %v, want %s", tt.name, err, tt.wantReason)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: normaliseICOInfo: %v", tt.name, err)
+			continue
+		}
+		if !closeTo(cfr, tt.wantCfr) || !closeTo(icoPrice, tt.wantIcoP) {
+			t.Errorf("%s: normaliseICOInfo returned funds raised %v, price %v, want %v, %v", tt.name, cfr, icoPrice, tt.wantCfr, tt.wantIcoP)
+		}
+	}
+
+	if _, _, err := (&Analyser{}).normaliseICOInfo(context.Background(), tests[0].icoInfo, icoStart, icoEnd, 400, 500); ReasonOf(err) != ReasonUnsupportedCurrency {
+		t.Errorf("normaliseICOInfo of BTC funds raised without currency converter returned error %v, want %s", err, ReasonUnsupportedCurrency)
+	}
+}
+
+func TestFundsRaisedDiffInReportingCurrency(t *testing.T) {
+	server := newCoinGeckoServer(coinGeckoPrices)
+	defer server.Close()
+
+	// 2.5M tokens at 0.001 ETH are 1M USD at ICO start rate, as are claimed 100 BTC at ICO end date
+	data := &types.ICOPassport{}
+	data.Metadata.Version = 1
+	data.IcoInfo = types.ICORatingData{
+		IcoStartDate: "01 Mar 2018",
+		IcoEndDate:   "31 Mar 2018",
+		IcoPrice:     0.001,
+		IcoPriceCur:  "ETH",
+		Cfr:          100,
+		CfrCurrency:  "BTC",
+	}
+	data.CalculatedData.TokensIssued = types.NewAmount(big.NewInt(2500000), 0)
+
+	a := &Analyser{
+		Prices:     fixedPrices{start: 400, end: 500},
+		Currencies: &CoinGeckoRates{URL: server.URL + "/history?date=%s"},
+	}
+	result, icoInfo, err := a.RunStages(context.Background(), data, Options{Stages: []string{StageEthRates, StageChecks}})
+	if err != nil {
+		t.Fatalf("RunStages: %v", err)
+	}
+
+	if !closeTo(result.CfrReporting, 1000000) || !closeTo(result.IcoPriceReporting, 0.4) {
+		t.Errorf("RunStages returned funds raised %v, price %v USD, want 1000000, 0.4", result.CfrReporting, result.IcoPriceReporting)
+	}
+	if check := result.TokenCheckResult.FundsRaisedResult; check.FundsRaisedCheck != types.CheckPassed || !closeTo(check.FundsRaisedDiff, 0) {
+		t.Errorf("RunStages returned token check %+v, want passed check without difference", check)
+	}
+
+	// the adjusted price stays in ICO price currency, ETH rate rose by 25% during ICO
+	if !closeTo(icoInfo.IcoPriceAdjusted, 0.00125) || icoInfo.IcoPriceCur != "ETH" {
+		t.Errorf("RunStages returned adjusted ICO price %v %s, want 0.00125 ETH", icoInfo.IcoPriceAdjusted, icoInfo.IcoPriceCur)
+	}
+	if !closeTo(result.IcoPriceAdjustedReporting, 0.5) || !closeTo(result.TokenCheckResult.FundsRaisedAdjustedDiff, 0.25) {
+		t.Errorf("RunStages returned adjusted price %v USD and difference %v, want 0.5 and 0.25",
+			result.IcoPriceAdjustedReporting, result.TokenCheckResult.FundsRaisedAdjustedDiff)
+	}
+}
@@ -0,0 +1,142 @@
+package analyser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// maxTokenDecimals is the largest number of decimals accepted from the token contract
+const maxTokenDecimals = 77
+
+var (
+	nameMethodID        = []byte{0x06, 0xfd, 0xde, 0x03}
+	symbolMethodID      = []byte{0x95, 0xd8, 0x9b, 0x41}
+	decimalsMethodID    = []byte{0x31, 0x3c, 0xe5, 0x67}
+	totalSupplyMethodID = []byte{0x18, 0x16, 0x0d, 0xdd}
+)
+
+// TokenMetadata is data read from ERC20 token contract
+type TokenMetadata struct {
+	Name   string
+	Symbol string
+	// Decimals is valid only when HasDecimals is true, decimals() is optional in ERC20
+	Decimals    int
+	HasDecimals bool
+	TotalSupply *big.Int
+}
+
+// TokenMetadataReader reads metadata of ERC20 token
+type TokenMetadataReader interface {
+	TokenMetadata(ctx context.Context, tokenAddress string) (metadata TokenMetadata, err error)
+}
+
+// ERC20Reader calls ERC20 view methods of the token contract
+type ERC20Reader struct {
+	Caller ethereum.ContractCaller
+}
+
+// NewERC20Reader creates token metadata reader which calls the contract, caller is usually *ethclient.Client
+func NewERC20Reader(caller ethereum.ContractCaller) *ERC20Reader {
+	return &ERC20Reader{Caller: caller}
+}
+
+// TokenMetadata implements TokenMetadataReader interface, optional name(), symbol() and decimals() are left empty
+// when the token doesn't implement them
+func (r *ERC20Reader) TokenMetadata(ctx context.Context, tokenAddress string) (metadata TokenMetadata, err error) {
+	token := common.HexToAddress(tokenAddress)
+
+	out, err := r.call(ctx, token, totalSupplyMethodID)
+	if err != nil {
+		return
+	}
+	if len(out) != common.HashLength {
+		err = &Error{Reason: ReasonMalformedTokenData, Err: fmt.Errorf("%s doesn't implement totalSupply()", tokenAddress)}
+		return
+	}
+	metadata.TotalSupply = new(big.Int).SetBytes(out)
+
+	if out, callErr := r.call(ctx, token, decimalsMethodID); callErr == nil && len(out) == common.HashLength {
+		decimals := new(big.Int).SetBytes(out)
+		if decimals.IsInt64() && decimals.Int64() <= maxTokenDecimals {
+			metadata.Decimals, metadata.HasDecimals = int(decimals.Int64()), true
+		}
+	}
+	if out, callErr := r.call(ctx, token, nameMethodID); callErr == nil {
+		metadata.Name = decodeString(out)
+	}
+	if out, callErr := r.call(ctx, token, symbolMethodID); callErr == nil {
+		metadata.Symbol = decodeString(out)
+	}
+	return
+}
+
+func (r *ERC20Reader) call(ctx context.Context, token common.Address, methodID []byte) ([]byte, error) {
+	return r.Caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: methodID}, nil)
+}
+
+// decodeString decodes ABI encoded string, early tokens return bytes32 instead
+func decodeString(out []byte) string {
+	if len(out) == common.HashLength {
+		return string(bytes.TrimRight(out, "\x00"))
+	}
+	if len(out) < 2*common.HashLength {
+		return ""
+	}
+
+	offset := new(big.Int).SetBytes(out[:common.HashLength])
+	if !offset.IsInt64() || offset.Int64()+common.HashLength > int64(len(out)) {
+		return ""
+	}
+	start := offset.Int64() + common.HashLength
+	length := new(big.Int).SetBytes(out[offset.Int64():start])
+	if !length.IsInt64() || start+length.Int64() > int64(len(out)) {
+		return ""
+	}
+	return string(out[start : start+length.Int64()])
+}
+
+// tokenInfo reads token metadata and on-chain total supply and resolves token decimals, on-chain decimals take
+// precedence over the caller-supplied value, conflicts and read failures are returned as warnings
+func (a *Analyser) tokenInfo(ctx context.Context, data *types.ICOAnalyzerData) (info *types.TokenInfo, totalSupply *types.Amount, warnings []string) {
+	reader := a.Tokens
+	if reader == nil {
+		if explorerReader, ok := a.Explorer.(TokenMetadataReader); ok {
+			reader = explorerReader
+		}
+	}
+	if reader == nil {
+		return
+	}
+
+	metadata, err := reader.TokenMetadata(ctx, strings.ToLower(data.TokenContractAddress))
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("token metadata is not available: %v", err))
+		log.Printf("warning: %s", warnings[len(warnings)-1])
+		return
+	}
+
+	if metadata.HasDecimals {
+		if data.Decimals != 0 && data.Decimals != metadata.Decimals {
+			warnings = append(warnings, fmt.Sprintf("supplied token decimals %d conflict with on-chain decimals %d, on-chain value is used", data.Decimals, metadata.Decimals))
+			log.Printf("warning: %s", warnings[len(warnings)-1])
+		}
+		data.Decimals = metadata.Decimals
+	}
+
+	info = &types.TokenInfo{
+		Name:     metadata.Name,
+		Symbol:   metadata.Symbol,
+		Decimals: data.Decimals,
+	}
+	supply := types.NewAmount(metadata.TotalSupply, data.Decimals)
+	totalSupply = &supply
+	return
+}
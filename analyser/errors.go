@@ -0,0 +1,60 @@
+package analyser
+
+import "fmt"
+
+// Reason is a stable code telling why the analysis failed, it's used as refund reason of the order
+type Reason string
+
+const (
+	// ReasonUnknownICO is used when ICO is not found by ICO metadata source
+	ReasonUnknownICO Reason = "unknown_ico"
+	// ReasonICOInfoUnavailable is used when ICO metadata source can't be reached or fails
+	ReasonICOInfoUnavailable Reason = "ico_info_unavailable"
+	// ReasonMalformedICOInfo is used when ICO metadata can't be parsed
+	ReasonMalformedICOInfo Reason = "malformed_ico_info"
+	// ReasonChainDataUnavailable is used when chain explorer can't be reached or fails
+	ReasonChainDataUnavailable Reason = "chain_data_unavailable"
+	// ReasonMalformedTokenData is used when token transfers are missing or can't be parsed
+	ReasonMalformedTokenData Reason = "malformed_token_data"
+	// ReasonPriceDataUnavailable is used when price oracle can't be reached or fails
+	ReasonPriceDataUnavailable Reason = "price_data_unavailable"
+	// ReasonPriceDataMissing is used when price oracle has no rates for the ICO period
+	ReasonPriceDataMissing Reason = "price_data_missing"
+	// ReasonUnsupportedCurrency is used when ICO currency can't be converted to the reporting currency
+	ReasonUnsupportedCurrency Reason = "unsupported_currency"
+	// ReasonCurrencyRateUnavailable is used when currency converter can't be reached or fails
+	ReasonCurrencyRateUnavailable Reason = "currency_rate_unavailable"
+	// ReasonInvalidInput is used when the request data can't be analysed
+	ReasonInvalidInput Reason = "invalid_input"
+	// ReasonInternal is used for all other failures
+	ReasonInternal Reason = "internal_error"
+)
+
+// Error is returned by the analyser when the analysis fails
+type Error struct {
+	Reason Reason
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
+
+// newError wraps err with the reason, errors which already have a reason are returned unchanged
+func newError(reason Reason, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{Reason: reason, Err: err}
+}
+
+// ReasonOf returns reason code of the error returned by the analyser
+func ReasonOf(err error) Reason {
+	if e, ok := err.(*Error); ok {
+		return e.Reason
+	}
+	return ReasonInternal
+}
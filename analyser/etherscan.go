@@ -1,12 +1,13 @@
 package analyser
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"math"
+	"math/big"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/monetha/ico-analyzer/types"
@@ -20,34 +21,54 @@ const (
 	etherScanURLForFund                = "https://api.etherscan.io/api?module=account&action=txlistinternal&address=%s&startblock=0&endblock=99999999&page=%d&offset=200&sort=asc&apikey=YourApiKeyToken"
 	etherScanURLForTokenCount          = "https://api.etherscan.io/api?module=account&action=tokentx&contractaddress=%s&address=%s&page=%d&offset=10000&sort=asc&apikey=YourApiKeyToken"
 	etherScanURLForTokenIssuingAddress = "https://api.etherscan.io/api?module=account&action=tokentx&contractaddress=%s&page=%d&offset=200&sort=asc&apikey=YourApiKeyToken"
+	etherScanURLForTokenTransfers      = "https://api.etherscan.io/api?module=account&action=tokentx&contractaddress=%s&startblock=%d&endblock=99999999&page=1&offset=10000&sort=asc&apikey=YourApiKeyToken"
+	etherScanURLForCode                = "https://api.etherscan.io/api?module=proxy&action=eth_getCode&address=%s&tag=latest&apikey=YourApiKeyToken"
+	etherScanURLForFirstExternalTxn    = "https://api.etherscan.io/api?module=account&action=txlist&address=%s&startblock=0&endblock=99999999&page=1&offset=1&sort=asc&apikey=YourApiKeyToken"
+	etherScanURLForFirstInternalTxn    = "https://api.etherscan.io/api?module=account&action=txlistinternal&address=%s&startblock=0&endblock=99999999&page=1&offset=1&sort=asc&apikey=YourApiKeyToken"
 	maxOffset                          = 10000
 )
 
-func getCrowdSaleBalance(address string) (balance float64, txnCount int64, err error) {
+// EtherScan fetches token and fund wallet data from etherscan.io API
+type EtherScan struct {
+	// Client is HTTP client used for requests, http.DefaultClient is used when nil
+	Client *http.Client
+}
 
-	extBalance, extTxCount, err := getBalance(etherScanURLForExternalTxns, address)
-	if err != nil {
-		return
-	}
+// NewEtherScan creates chain explorer backed by etherscan.io API
+func NewEtherScan() *EtherScan {
+	return &EtherScan{}
+}
 
-	internalBalance, inetrnalTxCount, err := getBalance(etherScanURLForInternalTxns, address)
+// CrowdSaleBalance implements ChainExplorer interface
+func (e *EtherScan) CrowdSaleBalance(ctx context.Context, address string) (balance *big.Int, txnCount int64, err error) {
+	contributions, err := e.CrowdSaleContributions(ctx, address)
 	if err != nil {
 		return
 	}
 
-	balance = extBalance + internalBalance
-	txnCount = extTxCount + inetrnalTxCount
-
+	balance, txnCount = sumContributions(contributions)
 	return
 }
 
-func getTokenCount(tokenAddress string, tokenDecimals int, icoEndDate time.Time) (tokenCount float64, tokenIssuingAddress string, tokenStartDate string, tokenEndDate string, err error) {
-	resp, err := http.Get(fmt.Sprintf(etherScanURLForTokenIssuingAddress, tokenAddress, 1))
+// CrowdSaleContributions implements ContributionLister interface
+func (e *EtherScan) CrowdSaleContributions(ctx context.Context, address string) (contributions []Contribution, err error) {
+	external, err := e.getContributions(ctx, etherScanURLForExternalTxns, address)
 	if err != nil {
 		return
 	}
 
-	txnInfoRaw, err := ioutil.ReadAll(resp.Body)
+	internal, err := e.getContributions(ctx, etherScanURLForInternalTxns, address)
+	if err != nil {
+		return
+	}
+
+	contributions = append(external, internal...)
+	return
+}
+
+// TokenCount implements ChainExplorer interface
+func (e *EtherScan) TokenCount(ctx context.Context, tokenAddress string, tokenDecimals int, icoEndDate time.Time) (tokenCount *big.Int, tokenIssuingAddress string, tokenStartDate string, tokenEndDate string, err error) {
+	txnInfoRaw, err := httpGet(ctx, e.Client, fmt.Sprintf(etherScanURLForTokenIssuingAddress, tokenAddress, 1))
 	if err != nil {
 		return
 	}
@@ -61,28 +82,18 @@ func getTokenCount(tokenAddress string, tokenDecimals int, icoEndDate time.Time)
 	tokenIssuingAddress = maxOccurrence(txnData.Result)
 
 	var page = 1
-	icoEndDateEpoch := icoEndDate.Unix()
-	tokenStartDateTmp := int64(0)
-	temp := int64(0)
-	// FLAGS
-	isTokenStrtDateSet := false
-	tokenEndDate = "" //just to be sure that nothing is passed in to the function.
+	distribution := newTokenDistribution(icoEndDate)
 
 	for {
-		resp, err := http.Get(fmt.Sprintf(etherScanURLForTokenCount, tokenAddress, tokenIssuingAddress, page))
+		txnInfoRaw, err := httpGet(ctx, e.Client, fmt.Sprintf(etherScanURLForTokenCount, tokenAddress, tokenIssuingAddress, page))
 		if err != nil {
-			return 0, "", "", "", err
-		}
-
-		txnInfoRaw, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return 0, "", "", "", err
+			return nil, "", "", "", err
 		}
 
 		var txnData types.EtherScanAllTxns
 		err = json.Unmarshal(txnInfoRaw, &txnData)
 		if err != nil {
-			return 0, "", "", "", err
+			return nil, "", "", "", err
 		}
 
 		if txnData.Message == noTxnFoundMsg {
@@ -90,54 +101,121 @@ func getTokenCount(tokenAddress string, tokenDecimals int, icoEndDate time.Time)
 		}
 
 		for _, txn := range txnData.Result {
-			txnValue, err := strconv.ParseFloat(txn.Value, 64)
+			txnValue, err := parseUnits(txn.Value)
 			if err != nil {
-				return 0, "", "", "", err
+				return nil, "", "", "", newError(ReasonMalformedTokenData, err)
 			}
-			if !isTokenStrtDateSet && txnValue != 0 { //checks for the first non zero txnValue and sets tokenStartDate
-				tokenStartDateTmp, err = strconv.ParseInt(txn.TimeStamp, 10, 64)
-				if err != nil {
-					return 0, "", "", "", err
-				}
-				tokenStartDateTime := time.Unix(tokenStartDateTmp, 0)
-				timeLayout := "02 Jan 2006"
-				tokenStartDate = tokenStartDateTime.Format(timeLayout)
-				isTokenStrtDateSet = true
-			} else {
-				tokenStartDateTmp, err = strconv.ParseInt(txn.TimeStamp, 10, 64)
-				if err != nil {
-					return 0, "", "", "", err
-				}
-				if tokenStartDateTmp > icoEndDateEpoch && tokenEndDate == "" {
-					if temp == 0 {
-						temp = icoEndDateEpoch
-					}
-					tokenEndDateTime := time.Unix(temp, 0)
-					timeLayout := "02 Jan 2006"
-					tokenEndDate = tokenEndDateTime.Format(timeLayout)
+			timestamp, err := strconv.ParseInt(txn.TimeStamp, 10, 64)
+			if err != nil {
+				return nil, "", "", "", newError(ReasonMalformedTokenData, err)
+			}
+			distribution.add(timestamp, txnValue)
+		}
 
-				}
-				temp = tokenStartDateTmp
+		if len(txnData.Result) < maxOffset {
+			break
+		}
+		page++
+	}
+
+	tokenCount, tokenStartDate, tokenEndDate = distribution.result()
+	return
+}
 
+// TokenTransfers implements TokenTransferLister interface, etherscan returns at most maxOffset results of a query
+// whatever page is requested, so transfers are listed by block ranges starting from the last block of the previous query
+func (e *EtherScan) TokenTransfers(ctx context.Context, tokenAddress string) (transfers []TokenTransfer, err error) {
+	var startBlock uint64
+	for {
+		var results []types.Result
+		found, err := e.getResult(ctx, fmt.Sprintf(etherScanURLForTokenTransfers, tokenAddress, startBlock), &results)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			break
+		}
+
+		complete := len(results) < maxOffset
+		if !complete {
+			// transfers of the last block may be cut off, they are listed again by the next query
+			lastBlock := results[len(results)-1].BlockNumber
+			for len(results) > 0 && results[len(results)-1].BlockNumber == lastBlock {
+				results = results[:len(results)-1]
+			}
+			if len(results) == 0 {
+				return nil, fmt.Errorf("etherscan: more than %d transfers of token %s in block %s", maxOffset, tokenAddress, lastBlock)
 			}
+			if startBlock, err = strconv.ParseUint(lastBlock, 10, 64); err != nil {
+				return nil, newError(ReasonMalformedTokenData, err)
+			}
+		}
 
-			tokenCount += txnValue / math.Pow10(tokenDecimals)
+		for _, txn := range results {
+			txnValue, err := parseUnits(txn.Value)
+			if err != nil {
+				return nil, newError(ReasonMalformedTokenData, err)
+			}
+			transfers = append(transfers, TokenTransfer{
+				From:  strings.ToLower(txn.From),
+				To:    strings.ToLower(txn.To),
+				Value: txnValue,
+			})
 		}
 
-		if len(txnData.Result) < maxOffset {
+		if complete {
 			break
 		}
-		page++
 	}
+	return
+}
 
-	if tokenEndDate == "" {
-		tokenEndDateTime := time.Unix(icoEndDateEpoch, 0)
-		timeLayout := "02 Jan 2006"
-		tokenEndDate = tokenEndDateTime.Format(timeLayout)
+// etherScanResponse is response of etherscan API, result of failed request is description of the error
+type etherScanResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// getResult requests etherscan API and decodes result of the response, false is returned when nothing is found
+func (e *EtherScan) getResult(ctx context.Context, url string, result interface{}) (found bool, err error) {
+	raw, err := httpGet(ctx, e.Client, url)
+	if err != nil {
+		return
 	}
+
+	var resp etherScanResponse
+	if err = json.Unmarshal(raw, &resp); err != nil {
+		return
+	}
+	if resp.Status != "1" {
+		if resp.Message == noTxnFoundMsg {
+			return
+		}
+		var description string
+		if json.Unmarshal(resp.Result, &description) != nil {
+			description = string(resp.Result)
+		}
+		err = fmt.Errorf("etherscan: %s: %s", resp.Message, description)
+		return
+	}
+
+	if err = json.Unmarshal(resp.Result, result); err != nil {
+		return
+	}
+	found = true
 	return
 }
 
+// parseUnits parses integer amount in wei or token base units returned by etherscan
+func parseUnits(s string) (*big.Int, error) {
+	value, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	return value, nil
+}
+
 func maxOccurrence(data []types.Result) (address string) {
 	addressCount := make(map[string]int64, 200)
 	var max int64
@@ -163,24 +241,18 @@ func maxOccurrenceFund(data []types.IntTxnResult) (address string) {
 	}
 	return
 }
-func getBalance(url string, address string) (balance float64, txnCount int64, err error) {
+func (e *EtherScan) getContributions(ctx context.Context, url string, address string) (contributions []Contribution, err error) {
 	var page = 1
-	txnCount = 0
 	for {
-		resp, err := http.Get(fmt.Sprintf(url, address, page))
-		if err != nil {
-			return balance, txnCount, err
-		}
-
-		txnInfoRaw, err := ioutil.ReadAll(resp.Body)
+		txnInfoRaw, err := httpGet(ctx, e.Client, fmt.Sprintf(url, address, page))
 		if err != nil {
-			return balance, txnCount, err
+			return contributions, err
 		}
 
 		var txnData types.EtherScanTrxWithErr
 		err = json.Unmarshal(txnInfoRaw, &txnData)
 		if err != nil {
-			return balance, txnCount, err
+			return contributions, err
 		}
 
 		if txnData.Message == noTxnFoundMsg {
@@ -189,12 +261,15 @@ func getBalance(url string, address string) (balance float64, txnCount int64, er
 
 		for _, txn := range txnData.Result {
 			if txn.IsError != "1" && txn.To == address {
-				txnValue, err := strconv.ParseFloat(txn.Value, 64)
+				txnValue, err := parseUnits(txn.Value)
 				if err != nil {
-					return balance, txnCount, err
+					return contributions, err
 				}
-				balance += txnValue / math.Pow10(18)
-				txnCount++
+				timestamp, err := strconv.ParseInt(txn.TimeStamp, 10, 64)
+				if err != nil {
+					return contributions, err
+				}
+				contributions = append(contributions, Contribution{Time: timestamp, Value: txnValue})
 			}
 		}
 
@@ -206,13 +281,9 @@ func getBalance(url string, address string) (balance float64, txnCount int64, er
 	return
 }
 
-func getEthBalance(address string) (fundAddress string, ethBalance float64, err error) {
-	resp, err := http.Get(fmt.Sprintf(etherScanURLForFund, address, 1))
-	if err != nil {
-		return
-	}
-
-	txnInfoRaw, err := ioutil.ReadAll(resp.Body)
+// EthBalance implements ChainExplorer interface
+func (e *EtherScan) EthBalance(ctx context.Context, address string) (fundAddress string, ethBalance *big.Int, err error) {
+	txnInfoRaw, err := httpGet(ctx, e.Client, fmt.Sprintf(etherScanURLForFund, address, 1))
 	if err != nil {
 		return
 	}
@@ -229,27 +300,121 @@ func getEthBalance(address string) (fundAddress string, ethBalance float64, err
 		fundAddress = address
 	}
 
-	resp, err = http.Get(fmt.Sprintf(etherScanBalance, fundAddress))
+	txnInfoRaw, err = httpGet(ctx, e.Client, fmt.Sprintf(etherScanBalance, fundAddress))
 	if err != nil {
 		return
 	}
 
-	txnInfoRaw, err = ioutil.ReadAll(resp.Body)
+	var balanceData types.EtherScanBalance
+	err = json.Unmarshal(txnInfoRaw, &balanceData)
 	if err != nil {
 		return
 	}
 
-	var balanceData types.EtherScanBalance
-	err = json.Unmarshal(txnInfoRaw, &balanceData)
+	ethBalance, err = parseUnits(balanceData.Result)
+	return
+}
+
+// Outflows implements OutflowExplorer interface
+func (e *EtherScan) Outflows(ctx context.Context, addresses []string) (outflows map[string][]Outflow, err error) {
+	outflows = make(map[string][]Outflow, len(addresses))
+	for _, address := range addresses {
+		for _, url := range []string{etherScanURLForExternalTxns, etherScanURLForInternalTxns} {
+			var sent []Outflow
+			if sent, err = e.getOutflows(ctx, url, address); err != nil {
+				return
+			}
+			outflows[address] = append(outflows[address], sent...)
+		}
+	}
+	return
+}
+
+func (e *EtherScan) getOutflows(ctx context.Context, url string, address string) (outflows []Outflow, err error) {
+	var page = 1
+	for {
+		txnInfoRaw, err := httpGet(ctx, e.Client, fmt.Sprintf(url, address, page))
+		if err != nil {
+			return outflows, err
+		}
+
+		var txnData types.EtherScanTrxWithErr
+		err = json.Unmarshal(txnInfoRaw, &txnData)
+		if err != nil {
+			return outflows, err
+		}
+
+		if txnData.Message == noTxnFoundMsg {
+			break
+		}
+
+		for _, txn := range txnData.Result {
+			if txn.IsError == "1" || txn.From != address || txn.Value == "0" {
+				continue
+			}
+			txnValue, err := parseUnits(txn.Value)
+			if err != nil {
+				return outflows, err
+			}
+			timestamp, err := strconv.ParseInt(txn.TimeStamp, 10, 64)
+			if err != nil {
+				return outflows, err
+			}
+			blockNumber, err := strconv.ParseUint(txn.BlockNumber, 10, 64)
+			if err != nil {
+				return outflows, err
+			}
+			outflows = append(outflows, Outflow{To: txn.To, BlockNumber: blockNumber, Time: timestamp, Value: txnValue})
+		}
+
+		if len(txnData.Result) < maxOffset {
+			break
+		}
+		page++
+	}
+	return
+}
+
+// IsContract implements OutflowExplorer interface
+func (e *EtherScan) IsContract(ctx context.Context, address string) (isContract bool, err error) {
+	codeRaw, err := httpGet(ctx, e.Client, fmt.Sprintf(etherScanURLForCode, address))
 	if err != nil {
 		return
 	}
 
-	ethBalance, err = strconv.ParseFloat(balanceData.Result, 64)
-	if err != nil {
+	var code struct {
+		Result string `json:"result"`
+	}
+	if err = json.Unmarshal(codeRaw, &code); err != nil {
 		return
 	}
-	ethBalance = ethBalance / math.Pow10(18)
 
+	isContract = code.Result != "" && code.Result != "0x"
 	return
 }
+
+// IsFresh implements OutflowExplorer interface
+func (e *EtherScan) IsFresh(ctx context.Context, address string, blockNumber uint64) (isFresh bool, err error) {
+	for _, url := range []string{etherScanURLForFirstExternalTxn, etherScanURLForFirstInternalTxn} {
+		txnInfoRaw, err := httpGet(ctx, e.Client, fmt.Sprintf(url, address))
+		if err != nil {
+			return false, err
+		}
+
+		var txnData types.EtherScanTrxWithErr
+		if err = json.Unmarshal(txnInfoRaw, &txnData); err != nil {
+			return false, err
+		}
+
+		if len(txnData.Result) > 0 {
+			first, err := strconv.ParseUint(txnData.Result[0].BlockNumber, 10, 64)
+			if err != nil {
+				return false, err
+			}
+			if first < blockNumber {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,91 @@
+package analyser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// etherScanTransport answers etherscan API requests by the function instead of etherscan.io
+type etherScanTransport func(query map[string][]string) interface{}
+
+func (f etherScanTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := json.Marshal(f(req.URL.Query()))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestEtherScanTokenTransfersByBlockRanges(t *testing.T) {
+	// more transfers than etherscan returns by a query, 3 transfers in every block
+	var all []types.Result
+	for i := 0; i < maxOffset+maxOffset/2; i++ {
+		all = append(all, types.Result{
+			BlockNumber: strconv.Itoa(i/3 + 1),
+			From:        zeroAddress,
+			To:          "0x00000000000000000000000000000000000000AA",
+			Value:       strconv.Itoa(i),
+		})
+	}
+
+	var queries int
+	e := &EtherScan{Client: &http.Client{Transport: etherScanTransport(func(query map[string][]string) interface{} {
+		queries++
+		if page := query["page"][0]; page != "1" {
+			return types.EtherScanBalance{Status: "0", Message: "NOTOK", Result: "Result window is too large"}
+		}
+		startBlock, _ := strconv.Atoi(query["startblock"][0])
+
+		var results []types.Result
+		for _, r := range all {
+			if block, _ := strconv.Atoi(r.BlockNumber); block >= startBlock && len(results) < maxOffset {
+				results = append(results, r)
+			}
+		}
+		if len(results) == 0 {
+			return types.EtherScanAllTxns{Status: "0", Message: noTxnFoundMsg, Result: []types.Result{}}
+		}
+		return types.EtherScanAllTxns{Status: "1", Message: "OK", Result: results}
+	})}}
+
+	transfers, err := e.TokenTransfers(context.Background(), "0x00000000000000000000000000000000000000cc")
+	if err != nil {
+		t.Fatalf("TokenTransfers: %v", err)
+	}
+	if len(transfers) != len(all) {
+		t.Fatalf("TokenTransfers returned %d transfers in %d queries, want %d", len(transfers), queries, len(all))
+	}
+	for i, transfer := range transfers {
+		if transfer.Value.Int64() != int64(i) || transfer.To != "0x00000000000000000000000000000000000000aa" {
+			t.Fatalf("TokenTransfers returned %+v as transfer %d", transfer, i)
+		}
+	}
+	if queries != 2 {
+		t.Errorf("TokenTransfers made %d queries, want 2", queries)
+	}
+}
+
+func TestEtherScanTokenTransfersError(t *testing.T) {
+	e := &EtherScan{Client: &http.Client{Transport: etherScanTransport(func(query map[string][]string) interface{} {
+		return types.EtherScanBalance{Status: "0", Message: "NOTOK", Result: "Max rate limit reached"}
+	})}}
+
+	_, err := e.TokenTransfers(context.Background(), "0x00000000000000000000000000000000000000cc")
+	if err == nil || !strings.Contains(err.Error(), "Max rate limit reached") {
+		t.Errorf("TokenTransfers returned error %v, want error of etherscan", err)
+	}
+}
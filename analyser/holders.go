@@ -0,0 +1,140 @@
+package analyser
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+const (
+	// topHoldersCount is number of the largest holders whose share is reported
+	topHoldersCount = 10
+	zeroAddress     = "0x0000000000000000000000000000000000000000"
+)
+
+// TokenTransfer is ERC20 Transfer event, addresses are lower case
+type TokenTransfer struct {
+	From string
+	To   string
+	// Value is transferred amount in token base units
+	Value *big.Int
+}
+
+// TokenTransferLister is chain explorer which lists all transfers of the token
+type TokenTransferLister interface {
+	// TokenTransfers returns all transfers of the token in chronological order
+	TokenTransfers(ctx context.Context, tokenAddress string) (transfers []TokenTransfer, err error)
+}
+
+// holderDistribution replays all token transfers, nil is returned when chain explorer can't list them,
+// team are addresses of the issuer and the team whose share is reported
+func (a *Analyser) holderDistribution(ctx context.Context, tokenAddress string, team ...string) (holders *types.HolderDistribution, err error) {
+	lister, ok := a.Explorer.(TokenTransferLister)
+	if !ok {
+		return
+	}
+
+	transfers, err := lister.TokenTransfers(ctx, strings.ToLower(tokenAddress))
+	if err == errNotSupported {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	holders = newHolderDistribution(transfers, team)
+	return
+}
+
+func newHolderDistribution(transfers []TokenTransfer, team []string) *types.HolderDistribution {
+	balances := make(map[string]*big.Int)
+	balance := func(address string) *big.Int {
+		b, ok := balances[address]
+		if !ok {
+			b = new(big.Int)
+			balances[address] = b
+		}
+		return b
+	}
+
+	recipients := make(map[string]bool)
+	for _, t := range transfers {
+		// tokens are minted from and burnt to zero address
+		if t.From != zeroAddress {
+			b := balance(t.From)
+			b.Sub(b, t.Value)
+		}
+		if t.To != zeroAddress {
+			b := balance(t.To)
+			b.Add(b, t.Value)
+			recipients[t.To] = true
+		}
+	}
+
+	var held []*big.Int
+	total := new(big.Int)
+	for _, b := range balances {
+		if b.Sign() > 0 {
+			held = append(held, b)
+			total.Add(total, b)
+		}
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i].Cmp(held[j]) < 0 })
+
+	holders := &types.HolderDistribution{
+		Holders:          int64(len(held)),
+		UniqueRecipients: int64(len(recipients)),
+		TopHoldersCount:  topHoldersCount,
+	}
+	if total.Sign() == 0 {
+		return holders
+	}
+
+	top := new(big.Int)
+	for i := len(held) - 1; i >= 0 && i >= len(held)-topHoldersCount; i-- {
+		top.Add(top, held[i])
+	}
+	holders.TopHoldersShare = share(top, total)
+
+	shares := make([]float64, len(held))
+	for i, b := range held {
+		shares[i] = share(b, total)
+	}
+	holders.Gini = gini(shares)
+
+	teamHeld := new(big.Int)
+	counted := make(map[string]bool, len(team))
+	for _, address := range team {
+		address = strings.ToLower(address)
+		if address == "" || counted[address] {
+			continue
+		}
+		counted[address] = true
+		if b, ok := balances[address]; ok && b.Sign() > 0 {
+			teamHeld.Add(teamHeld, b)
+		}
+	}
+	holders.IssuerShare = share(teamHeld, total)
+	return holders
+}
+
+// share returns part / total as float
+func share(part, total *big.Int) float64 {
+	f, _ := new(big.Rat).SetFrac(part, total).Float64()
+	return f
+}
+
+// gini returns Gini coefficient of the shares sorted in ascending order, 0 is perfect equality
+func gini(sorted []float64) float64 {
+	n := float64(len(sorted))
+	var weighted, total float64
+	for i, v := range sorted {
+		weighted += float64(i+1) * v
+		total += v
+	}
+	return 2*weighted/(n*total) - (n+1)/n
+}
@@ -0,0 +1,47 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// statusError is returned when remote server responds with non-OK status code
+type statusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("GET %s: unexpected status %s", e.URL, e.Status)
+}
+
+// httpGet performs GET request bound to the context and returns response body
+func httpGet(ctx context.Context, client *http.Client, url string) (body []byte, err error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = &statusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return
+}
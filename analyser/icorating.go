@@ -1,9 +1,9 @@
 package analyser
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
@@ -15,13 +15,23 @@ import (
 
 const baseURL = "https://icorating.com/ico/%s/"
 
-func icoRating(icoName string) (data types.ICORatingData, icoStartDate time.Time, icoEndDate time.Time, err error) {
-	resp, err := http.Get(fmt.Sprintf(baseURL, icoName))
-	if err != nil {
-		return
-	}
+// ICORating fetches ICO metadata from icorating.com
+type ICORating struct {
+	// Client is HTTP client used for requests, http.DefaultClient is used when nil
+	Client *http.Client
+}
 
-	icoInfoRaw, err := ioutil.ReadAll(resp.Body)
+// NewICORating creates ICO metadata source backed by icorating.com
+func NewICORating() *ICORating {
+	return &ICORating{}
+}
+
+// ICOInfo implements ICOInfoSource interface
+func (r *ICORating) ICOInfo(ctx context.Context, icoName string) (data types.ICORatingData, icoStartDate time.Time, icoEndDate time.Time, err error) {
+	icoInfoRaw, err := httpGet(ctx, r.Client, fmt.Sprintf(baseURL, icoName))
+	if se, ok := err.(*statusError); ok && se.StatusCode == http.StatusNotFound {
+		err = &Error{Reason: ReasonUnknownICO, Err: errors.New("Invalid Ico name")}
+	}
 	if err != nil {
 		return
 	}
@@ -37,7 +47,7 @@ func icoRating(icoName string) (data types.ICORatingData, icoStartDate time.Time
 	}
 
 	if len(tables) == 0 {
-		err := errors.New("Invalid Ico name")
+		err := &Error{Reason: ReasonUnknownICO, Err: errors.New("Invalid Ico name")}
 		return data, icoStartDate, icoEndDate, err
 	}
 
@@ -55,6 +65,7 @@ func icoRating(icoName string) (data types.ICORatingData, icoStartDate time.Time
 	raised := strings.Split(dataMap["Raised"], " ")
 	claimedFundsRaised, err := strconv.Atoi(strings.Replace(raised[0], ",", "", 10))
 	if err != nil {
+		err = newError(ReasonMalformedICOInfo, err)
 		return
 	}
 	claimedFundsRaisedCurreny := raised[1]
@@ -62,6 +73,7 @@ func icoRating(icoName string) (data types.ICORatingData, icoStartDate time.Time
 	price := strings.Split(strings.TrimPrefix(dataMap["Price"], "= "), " ")
 	icoPrice, err := strconv.ParseFloat(price[0], 64)
 	if err != nil {
+		err = newError(ReasonMalformedICOInfo, err)
 		return
 	}
 	icoPriceCurrency := price[1]
@@ -69,11 +81,13 @@ func icoRating(icoName string) (data types.ICORatingData, icoStartDate time.Time
 	timeLayout := "02 Jan 2006"
 	icoStartDate, err = time.Parse(timeLayout, dataMap["ICO start date"])
 	if err != nil {
+		err = newError(ReasonMalformedICOInfo, err)
 		return
 	}
 
 	icoEndDate, err = time.Parse(timeLayout, dataMap["ICO end date"])
 	if err != nil {
+		err = newError(ReasonMalformedICOInfo, err)
 		return
 	}
 
@@ -85,5 +99,23 @@ func icoRating(icoName string) (data types.ICORatingData, icoStartDate time.Time
 		IcoPrice:     icoPrice,
 		IcoPriceCur:  icoPriceCurrency,
 	}
+	// caps are not published for every ICO
+	data.SoftCap, data.SoftCapCurrency = parseCap(dataMap["Soft cap"])
+	data.HardCap, data.HardCapCurrency = parseCap(dataMap["Hard cap"])
+	return
+}
+
+// parseCap parses amount with currency like "30,000,000 USD", zero is returned when the value can't be parsed
+func parseCap(s string) (amount float64, currency string) {
+	parts := strings.Fields(s)
+	if len(parts) < 2 {
+		return
+	}
+
+	amount, err := strconv.ParseFloat(strings.Replace(parts[0], ",", "", -1), 64)
+	if err != nil || amount <= 0 {
+		return 0, ""
+	}
+	currency = parts[1]
 	return
 }
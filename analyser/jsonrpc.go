@@ -0,0 +1,686 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// TraceModeAuto tries trace_filter first and falls back to debug_traceTransaction
+	TraceModeAuto = ""
+	// TraceModeFilter uses Parity/OpenEthereum trace_filter method for internal transactions
+	TraceModeFilter = "trace_filter"
+	// TraceModeDebug uses Geth debug_traceTransaction method with callTracer for internal transactions
+	TraceModeDebug = "debug"
+	// TraceModeNone disables internal transactions lookup
+	TraceModeNone = "none"
+
+	defaultLogsBlockRange = 100000
+	issuerSampleSize      = 200
+)
+
+var transferEventTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// JSONRPCBackend is the subset of Ethereum node API used by JSONRPCExplorer, it is implemented by *ethclient.Client
+type JSONRPCBackend interface {
+	ethereum.LogFilterer
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*ethtypes.Receipt, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*ethtypes.Header, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*ethtypes.Block, error)
+}
+
+// Tracer calls tracing methods of Ethereum node, it is implemented by *rpc.Client
+type Tracer interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// JSONRPCExplorer computes token and fund wallet data directly from Ethereum node
+type JSONRPCExplorer struct {
+	Backend JSONRPCBackend
+	// Tracer is used to find internal transactions, they are ignored when Tracer is nil
+	Tracer Tracer
+	// TraceMode selects tracing method used to find internal transactions
+	TraceMode string
+	// FromBlock is the first block scanned for transactions and logs, blocks are fetched one by one from it
+	// up to the latest block, so it should be close to the ICO start
+	FromBlock uint64
+	// LogsBlockRange is maximum number of blocks requested in single eth_getLogs call
+	LogsBlockRange uint64
+
+	// mu guards the caches and the trace mode fallback
+	mu        sync.Mutex
+	headers   map[uint64]*ethtypes.Header
+	transfers map[common.Address][]tokenTransfer
+	// debugFallback is set when trace_filter failed in auto trace mode
+	debugFallback bool
+
+	// scanMu serialises the block scan, so blocks are fetched once however many lookups need them
+	scanMu  sync.Mutex
+	scanned *blockScan
+	// traced are internal transfers of all contract calls found by debug_traceTransaction
+	traced []internalTransfer
+}
+
+// NewJSONRPCExplorer creates chain explorer backed by Ethereum node
+func NewJSONRPCExplorer(backend JSONRPCBackend, tracer Tracer) *JSONRPCExplorer {
+	return &JSONRPCExplorer{
+		Backend:        backend,
+		Tracer:         tracer,
+		LogsBlockRange: defaultLogsBlockRange,
+	}
+}
+
+// tokenTransfer is decoded ERC20 Transfer event
+type tokenTransfer struct {
+	BlockNumber uint64
+	From        common.Address
+	To          common.Address
+	Value       *big.Int
+}
+
+// blockScan is ETH transfers and contract calls of all blocks from FromBlock, collected by a single pass over the blocks
+type blockScan struct {
+	// transfers are top level transactions with value, receipts are not checked yet
+	transfers []ethTransfer
+	// calls are transactions with input data, they are traced by debug_traceTransaction
+	calls []contractCall
+}
+
+// ethTransfer is ETH sent by a top level transaction
+type ethTransfer struct {
+	BlockNumber uint64
+	Time        int64
+	TxHash      common.Hash
+	From        common.Address
+	To          common.Address
+	Value       *big.Int
+}
+
+// contractCall is transaction with input data
+type contractCall struct {
+	BlockNumber uint64
+	TxHash      common.Hash
+}
+
+// internalTransfer is ETH transfer made by a contract
+type internalTransfer struct {
+	BlockNumber uint64
+	TxHash      common.Hash
+	From        common.Address
+	To          common.Address
+	Value       *big.Int
+}
+
+// TokenCount implements ChainExplorer interface
+func (e *JSONRPCExplorer) TokenCount(ctx context.Context, tokenAddress string, tokenDecimals int, icoEndDate time.Time) (tokenCount *big.Int, tokenIssuingAddress string, tokenStartDate string, tokenEndDate string, err error) {
+	transfers, err := e.tokenTransfers(ctx, common.HexToAddress(tokenAddress))
+	if err != nil {
+		return
+	}
+	if len(transfers) == 0 {
+		err = &Error{Reason: ReasonMalformedTokenData, Err: fmt.Errorf("no transfers of token %s found", tokenAddress)}
+		return
+	}
+
+	sample := transfers
+	if len(sample) > issuerSampleSize {
+		sample = sample[:issuerSampleSize]
+	}
+	issuer := maxOccurrenceSender(sample)
+	tokenIssuingAddress = strings.ToLower(issuer.Hex())
+
+	// same as etherscan tokentx for the issuing address, transfers in both directions are accounted
+	distribution := newTokenDistribution(icoEndDate)
+	for _, t := range transfers {
+		if t.From != issuer && t.To != issuer {
+			continue
+		}
+
+		header, err := e.header(ctx, t.BlockNumber)
+		if err != nil {
+			return nil, "", "", "", err
+		}
+		distribution.add(header.Time.Int64(), t.Value)
+	}
+
+	tokenCount, tokenStartDate, tokenEndDate = distribution.result()
+	return
+}
+
+// CrowdSaleBalance implements ChainExplorer interface
+func (e *JSONRPCExplorer) CrowdSaleBalance(ctx context.Context, address string) (balance *big.Int, txnCount int64, err error) {
+	contributions, err := e.CrowdSaleContributions(ctx, address)
+	if err != nil {
+		return
+	}
+
+	balance, txnCount = sumContributions(contributions)
+	return
+}
+
+// CrowdSaleContributions implements ContributionLister interface
+func (e *JSONRPCExplorer) CrowdSaleContributions(ctx context.Context, address string) (contributions []Contribution, err error) {
+	addr := common.HexToAddress(address)
+
+	scan, err := e.scan(ctx)
+	if err != nil {
+		return
+	}
+	for _, t := range scan.transfers {
+		if t.To != addr {
+			continue
+		}
+
+		ok, err := e.succeeded(ctx, t.TxHash)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			contributions = append(contributions, Contribution{Time: t.Time, Value: t.Value})
+		}
+	}
+
+	internal, err := e.internalTransfers(ctx, []common.Address{addr}, false)
+	if err != nil {
+		return
+	}
+	for _, t := range internal {
+		header, err := e.header(ctx, t.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		contributions = append(contributions, Contribution{Time: header.Time.Int64(), Value: t.Value})
+	}
+	return
+}
+
+// EthBalance implements ChainExplorer interface
+func (e *JSONRPCExplorer) EthBalance(ctx context.Context, address string) (fundAddress string, ethBalance *big.Int, err error) {
+	addr := common.HexToAddress(address)
+
+	internal, err := e.internalTransfers(ctx, []common.Address{addr}, true)
+	if err != nil {
+		return
+	}
+	if len(internal) > issuerSampleSize {
+		internal = internal[:issuerSampleSize]
+	}
+
+	fund := maxOccurrenceRecipient(internal)
+	if fund == (common.Address{}) {
+		fund = addr
+	}
+	fundAddress = strings.ToLower(fund.Hex())
+
+	ethBalance, err = e.Backend.BalanceAt(ctx, fund, nil)
+	return
+}
+
+// TokenTransfers implements TokenTransferLister interface
+func (e *JSONRPCExplorer) TokenTransfers(ctx context.Context, tokenAddress string) (transfers []TokenTransfer, err error) {
+	tt, err := e.tokenTransfers(ctx, common.HexToAddress(tokenAddress))
+	if err != nil {
+		return
+	}
+
+	transfers = make([]TokenTransfer, 0, len(tt))
+	for _, t := range tt {
+		transfers = append(transfers, TokenTransfer{
+			From:  strings.ToLower(t.From.Hex()),
+			To:    strings.ToLower(t.To.Hex()),
+			Value: t.Value,
+		})
+	}
+	return
+}
+
+// tokenTransfers returns all ERC20 Transfer events of the token in chronological order,
+// transfers are cached to avoid scanning logs of the same token twice
+func (e *JSONRPCExplorer) tokenTransfers(ctx context.Context, tokenAddress common.Address) (transfers []tokenTransfer, err error) {
+	e.mu.Lock()
+	cached, ok := e.transfers[tokenAddress]
+	e.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	defer func() {
+		if err == nil {
+			e.mu.Lock()
+			if e.transfers == nil {
+				e.transfers = make(map[common.Address][]tokenTransfer)
+			}
+			e.transfers[tokenAddress] = transfers
+			e.mu.Unlock()
+		}
+	}()
+
+	head, err := e.Backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return
+	}
+	last := head.Number.Uint64()
+
+	blockRange := e.LogsBlockRange
+	if blockRange == 0 {
+		blockRange = defaultLogsBlockRange
+	}
+
+	for from := e.FromBlock; from <= last; from += blockRange {
+		to := from + blockRange - 1
+		if to > last {
+			to = last
+		}
+
+		logs, err := e.Backend.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+			Addresses: []common.Address{tokenAddress},
+			Topics:    [][]common.Hash{{transferEventTopic}},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, l := range logs {
+			// ERC721 and non-standard tokens index the value or don't have it at all
+			if l.Removed || len(l.Topics) != 3 || len(l.Data) != common.HashLength {
+				continue
+			}
+			transfers = append(transfers, tokenTransfer{
+				BlockNumber: l.BlockNumber,
+				From:        common.BytesToAddress(l.Topics[1].Bytes()),
+				To:          common.BytesToAddress(l.Topics[2].Bytes()),
+				Value:       new(big.Int).SetBytes(l.Data),
+			})
+		}
+	}
+	return
+}
+
+// scanBlocks calls fn for every block starting from FromBlock up to the latest block
+func (e *JSONRPCExplorer) scanBlocks(ctx context.Context, fn func(block *ethtypes.Block) error) error {
+	head, err := e.Backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for n := e.FromBlock; n <= head.Number.Uint64(); n++ {
+		block, err := e.Backend.BlockByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return err
+		}
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan returns ETH transfers and contract calls of all blocks from FromBlock, blocks are fetched by the first call only
+func (e *JSONRPCExplorer) scan(ctx context.Context) (*blockScan, error) {
+	e.scanMu.Lock()
+	defer e.scanMu.Unlock()
+	if e.scanned != nil {
+		return e.scanned, nil
+	}
+
+	scan := new(blockScan)
+	collectCalls := e.traceMode() == TraceModeDebug || e.traceMode() == TraceModeAuto
+	err := e.scanBlocks(ctx, func(block *ethtypes.Block) error {
+		for _, tx := range block.Transactions() {
+			if collectCalls && len(tx.Data()) > 0 {
+				scan.calls = append(scan.calls, contractCall{BlockNumber: block.NumberU64(), TxHash: tx.Hash()})
+			}
+
+			if tx.To() == nil || tx.Value().Sign() == 0 {
+				continue
+			}
+			from, err := txSender(tx)
+			if err != nil {
+				continue
+			}
+			scan.transfers = append(scan.transfers, ethTransfer{
+				BlockNumber: block.NumberU64(),
+				Time:        block.Time().Int64(),
+				TxHash:      tx.Hash(),
+				From:        from,
+				To:          *tx.To(),
+				Value:       tx.Value(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.scanned = scan
+	return scan, nil
+}
+
+// succeeded returns true if the mined transaction didn't fail
+func (e *JSONRPCExplorer) succeeded(ctx context.Context, txHash common.Hash) (bool, error) {
+	receipt, err := e.Backend.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return false, err
+	}
+	return receipt.Status == ethtypes.ReceiptStatusSuccessful, nil
+}
+
+// header returns block header, headers are cached to avoid repeated requests for transfers in the same block
+func (e *JSONRPCExplorer) header(ctx context.Context, number uint64) (*ethtypes.Header, error) {
+	e.mu.Lock()
+	h, ok := e.headers[number]
+	e.mu.Unlock()
+	if ok {
+		return h, nil
+	}
+
+	h, err := e.Backend.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	if e.headers == nil {
+		e.headers = make(map[uint64]*ethtypes.Header)
+	}
+	e.headers[number] = h
+	e.mu.Unlock()
+	return h, nil
+}
+
+// traceMode returns tracing method in use, auto mode turns into debug mode once trace_filter fails
+func (e *JSONRPCExplorer) traceMode() string {
+	if e.Tracer == nil {
+		return TraceModeNone
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.TraceMode == TraceModeAuto && e.debugFallback {
+		return TraceModeDebug
+	}
+	return e.TraceMode
+}
+
+// internalTransfers returns successful internal ETH transfers sent from (outgoing is true) or to the addresses
+func (e *JSONRPCExplorer) internalTransfers(ctx context.Context, addresses []common.Address, outgoing bool) ([]internalTransfer, error) {
+	switch mode := e.traceMode(); mode {
+	case TraceModeNone:
+		return nil, nil
+	case TraceModeFilter:
+		return e.traceFilter(ctx, addresses, outgoing)
+	case TraceModeDebug:
+		return e.debugTrace(ctx, addresses, outgoing)
+	case TraceModeAuto:
+		transfers, err := e.traceFilter(ctx, addresses, outgoing)
+		if err == nil {
+			return transfers, nil
+		}
+		log.Printf("warning: trace_filter failed (%v), falling back to debug_traceTransaction", err)
+		e.mu.Lock()
+		e.debugFallback = true
+		e.mu.Unlock()
+		return e.debugTrace(ctx, addresses, outgoing)
+	default:
+		return nil, fmt.Errorf("unknown trace mode %q", mode)
+	}
+}
+
+type traceFilterResult struct {
+	Action struct {
+		CallType string         `json:"callType"`
+		From     common.Address `json:"from"`
+		To       common.Address `json:"to"`
+		Value    *hexutil.Big   `json:"value"`
+	} `json:"action"`
+	BlockNumber     uint64      `json:"blockNumber"`
+	Error           string      `json:"error"`
+	TraceAddress    []int       `json:"traceAddress"`
+	TransactionHash common.Hash `json:"transactionHash"`
+	Type            string      `json:"type"`
+}
+
+func (e *JSONRPCExplorer) traceFilter(ctx context.Context, addresses []common.Address, outgoing bool) (transfers []internalTransfer, err error) {
+	filter := map[string]interface{}{
+		"fromBlock": hexutil.EncodeUint64(e.FromBlock),
+		"toBlock":   "latest",
+	}
+	if outgoing {
+		filter["fromAddress"] = addresses
+	} else {
+		filter["toAddress"] = addresses
+	}
+
+	var traces []traceFilterResult
+	if err = e.Tracer.CallContext(ctx, &traces, "trace_filter", filter); err != nil {
+		return
+	}
+
+	for _, t := range traces {
+		// top level calls are ordinary transactions, they are accounted separately
+		if t.Type != "call" || len(t.TraceAddress) == 0 || t.Error != "" || t.Action.Value == nil {
+			continue
+		}
+		value := t.Action.Value.ToInt()
+		if value.Sign() == 0 {
+			continue
+		}
+		transfers = append(transfers, internalTransfer{
+			BlockNumber: t.BlockNumber,
+			TxHash:      t.TransactionHash,
+			From:        t.Action.From,
+			To:          t.Action.To,
+			Value:       value,
+		})
+	}
+	return
+}
+
+type callFrame struct {
+	Type  string         `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+// debugTrace returns internal transfers from or to the addresses found by tracing contract calls of the block scan
+func (e *JSONRPCExplorer) debugTrace(ctx context.Context, addresses []common.Address, outgoing bool) (transfers []internalTransfer, err error) {
+	all, err := e.debugTransfers(ctx)
+	if err != nil {
+		return
+	}
+
+	traced := make(map[common.Address]bool, len(addresses))
+	for _, address := range addresses {
+		traced[address] = true
+	}
+
+	for _, t := range all {
+		if (outgoing && traced[t.From]) || (!outgoing && traced[t.To]) {
+			transfers = append(transfers, t)
+		}
+	}
+	return
+}
+
+// debugTransfers traces every contract call of the block scan with debug_traceTransaction once
+// and returns all successful internal ETH transfers
+func (e *JSONRPCExplorer) debugTransfers(ctx context.Context) ([]internalTransfer, error) {
+	scan, err := e.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e.scanMu.Lock()
+	defer e.scanMu.Unlock()
+	if e.traced != nil {
+		return e.traced, nil
+	}
+
+	transfers := []internalTransfer{}
+	for _, call := range scan.calls {
+		var frame callFrame
+		err = e.Tracer.CallContext(ctx, &frame, "debug_traceTransaction", call.TxHash, map[string]string{"tracer": "callTracer"})
+		if err != nil {
+			return nil, err
+		}
+		if frame.Error != "" {
+			continue
+		}
+
+		var walk func(calls []callFrame)
+		walk = func(calls []callFrame) {
+			for _, c := range calls {
+				if c.Error != "" {
+					continue
+				}
+				if c.Value != nil && c.Value.ToInt().Sign() > 0 && c.Type != "DELEGATECALL" {
+					transfers = append(transfers, internalTransfer{
+						BlockNumber: call.BlockNumber,
+						TxHash:      call.TxHash,
+						From:        c.From,
+						To:          c.To,
+						Value:       c.Value.ToInt(),
+					})
+				}
+				walk(c.Calls)
+			}
+		}
+		walk(frame.Calls)
+	}
+
+	e.traced = transfers
+	return transfers, nil
+}
+
+// Outflows implements OutflowExplorer interface
+func (e *JSONRPCExplorer) Outflows(ctx context.Context, addresses []string) (outflows map[string][]Outflow, err error) {
+	traced := make(map[common.Address]bool, len(addresses))
+	tracedList := make([]common.Address, 0, len(addresses))
+	for _, address := range addresses {
+		addr := common.HexToAddress(address)
+		traced[addr] = true
+		tracedList = append(tracedList, addr)
+	}
+
+	outflows = make(map[string][]Outflow, len(addresses))
+	add := func(from, to common.Address, blockNumber uint64, blockTime int64, value *big.Int) {
+		key := strings.ToLower(from.Hex())
+		outflows[key] = append(outflows[key], Outflow{
+			To:          strings.ToLower(to.Hex()),
+			BlockNumber: blockNumber,
+			Time:        blockTime,
+			Value:       value,
+		})
+	}
+
+	// every hop reuses the transfers of the single block scan
+	scan, err := e.scan(ctx)
+	if err != nil {
+		return
+	}
+	for _, t := range scan.transfers {
+		if !traced[t.From] {
+			continue
+		}
+
+		ok, err := e.succeeded(ctx, t.TxHash)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			add(t.From, t.To, t.BlockNumber, t.Time, t.Value)
+		}
+	}
+
+	internal, err := e.internalTransfers(ctx, tracedList, true)
+	if err != nil {
+		return
+	}
+	for _, t := range internal {
+		header, err := e.header(ctx, t.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		add(t.From, t.To, t.BlockNumber, header.Time.Int64(), t.Value)
+	}
+	return
+}
+
+// IsContract implements OutflowExplorer interface
+func (e *JSONRPCExplorer) IsContract(ctx context.Context, address string) (bool, error) {
+	code, err := e.Backend.CodeAt(ctx, common.HexToAddress(address), nil)
+	return len(code) > 0, err
+}
+
+// IsFresh implements OutflowExplorer interface, the node must keep historical state (archive node)
+func (e *JSONRPCExplorer) IsFresh(ctx context.Context, address string, blockNumber uint64) (bool, error) {
+	if blockNumber == 0 {
+		return false, nil
+	}
+
+	addr := common.HexToAddress(address)
+	before := new(big.Int).SetUint64(blockNumber - 1)
+	nonce, err := e.Backend.NonceAt(ctx, addr, before)
+	if err != nil || nonce > 0 {
+		return false, err
+	}
+
+	balance, err := e.Backend.BalanceAt(ctx, addr, before)
+	if err != nil {
+		return false, err
+	}
+	return balance.Sign() == 0, nil
+}
+
+// txSender recovers sender of the transaction signed with or without replay protection
+func txSender(tx *ethtypes.Transaction) (common.Address, error) {
+	if tx.Protected() {
+		return ethtypes.Sender(ethtypes.NewEIP155Signer(tx.ChainId()), tx)
+	}
+	return ethtypes.Sender(ethtypes.HomesteadSigner{}, tx)
+}
+
+func maxOccurrenceSender(data []tokenTransfer) (address common.Address) {
+	addressCount := make(map[common.Address]int64, len(data))
+	var max int64
+	for _, d := range data {
+		addressCount[d.From]++
+		if addressCount[d.From] >= max {
+			max = addressCount[d.From]
+			address = d.From
+		}
+	}
+	return
+}
+
+func maxOccurrenceRecipient(data []internalTransfer) (address common.Address) {
+	addressCount := make(map[common.Address]int64, len(data))
+	var max int64
+	for _, d := range data {
+		addressCount[d.To]++
+		if addressCount[d.To] >= max {
+			max = addressCount[d.To]
+			address = d.To
+		}
+	}
+	return
+}
@@ -0,0 +1,213 @@
+package analyser
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// simulatedChain is JSONRPCBackend on top of simulated backend, it keeps blocks committed through it,
+// because simulated backend doesn't return blocks and headers; block times are 10 seconds apart
+type simulatedChain struct {
+	*backends.SimulatedBackend
+	blocks  []*ethtypes.Block
+	pending []*ethtypes.Transaction
+}
+
+func newSimulatedChain(alloc core.GenesisAlloc) *simulatedChain {
+	genesis := &ethtypes.Header{Number: new(big.Int), Time: new(big.Int)}
+	return &simulatedChain{
+		SimulatedBackend: backends.NewSimulatedBackend(alloc, 10000000),
+		blocks:           []*ethtypes.Block{ethtypes.NewBlockWithHeader(genesis)},
+	}
+}
+
+func (c *simulatedChain) SendTransaction(ctx context.Context, tx *ethtypes.Transaction) error {
+	if err := c.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, tx)
+	return nil
+}
+
+// Commit mines pending transactions into a new block
+func (c *simulatedChain) Commit() {
+	c.SimulatedBackend.Commit()
+	n := int64(len(c.blocks))
+	header := &ethtypes.Header{Number: big.NewInt(n), Time: big.NewInt(n * 10)}
+	c.blocks = append(c.blocks, ethtypes.NewBlockWithHeader(header).WithBody(c.pending, nil))
+	c.pending = nil
+}
+
+func (c *simulatedChain) HeaderByNumber(ctx context.Context, number *big.Int) (*ethtypes.Header, error) {
+	block, err := c.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return block.Header(), nil
+}
+
+func (c *simulatedChain) BlockByNumber(ctx context.Context, number *big.Int) (*ethtypes.Block, error) {
+	if number == nil {
+		return c.blocks[len(c.blocks)-1], nil
+	}
+	if !number.IsUint64() || number.Uint64() >= uint64(len(c.blocks)) {
+		return nil, ethereum.NotFound
+	}
+	return c.blocks[number.Uint64()], nil
+}
+
+// send sends transaction signed by the key and mines it, transaction to nil address deploys contract
+func (c *simulatedChain) send(t *testing.T, key *ecdsa.PrivateKey, to *common.Address, value *big.Int, data []byte) *ethtypes.Transaction {
+	t.Helper()
+	ctx := context.Background()
+
+	nonce, err := c.PendingNonceAt(ctx, crypto.PubkeyToAddress(key.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tx *ethtypes.Transaction
+	if to == nil {
+		tx = ethtypes.NewContractCreation(nonce, value, 1000000, big.NewInt(1), data)
+	} else {
+		tx = ethtypes.NewTransaction(nonce, *to, value, 1000000, big.NewInt(1), data)
+	}
+	if tx, err = ethtypes.SignTx(tx, ethtypes.HomesteadSigner{}, key); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	c.Commit()
+	return tx
+}
+
+// tokenCode is creation code of contract which emits Transfer(msg.sender, to, value) event for call data (to, value)
+func tokenCode() []byte {
+	runtime := []byte{
+		0x60, 0x20, 0x60, 0x20, 0x60, 0x00, 0x37, // CALLDATACOPY(0, 32, 32): value to memory
+		0x60, 0x00, 0x35, // CALLDATALOAD(0): to
+		0x33, // CALLER: from
+		0x7f, // PUSH32 Transfer event topic
+	}
+	runtime = append(runtime, transferEventTopic.Bytes()...)
+	runtime = append(runtime,
+		0x60, 0x20, 0x60, 0x00, 0xa3, // LOG3(0, 32, topic, from, to)
+		0x00, // STOP
+	)
+
+	size := byte(len(runtime))
+	code := []byte{
+		0x60, size, 0x60, 0x0c, 0x60, 0x00, 0x39, // CODECOPY(0, 12, size)
+		0x60, size, 0x60, 0x00, 0xf3, // RETURN(0, size)
+	}
+	return append(code, runtime...)
+}
+
+func transferData(to common.Address, value *big.Int) []byte {
+	return append(common.LeftPadBytes(to.Bytes(), common.HashLength), common.LeftPadBytes(value.Bytes(), common.HashLength)...)
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.Ether))
+}
+
+func TestJSONRPCExplorerSimulatedBackend(t *testing.T) {
+	ctx := context.Background()
+
+	issuerKey, _ := crypto.GenerateKey()
+	investorKey, _ := crypto.GenerateKey()
+	issuer := crypto.PubkeyToAddress(issuerKey.PublicKey)
+	investor := crypto.PubkeyToAddress(investorKey.PublicKey)
+	crowdsale := common.HexToAddress("0x00000000000000000000000000000000000c0ffe")
+	holder1 := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	holder2 := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	other := common.HexToAddress("0x0000000000000000000000000000000000000003")
+
+	chain := newSimulatedChain(core.GenesisAlloc{
+		issuer:   {Balance: ether(10)},
+		investor: {Balance: ether(10)},
+	})
+
+	chain.send(t, issuerKey, nil, new(big.Int), tokenCode())
+	token := crypto.CreateAddress(issuer, 0)
+
+	// both values are above 2^53, so they are not exact as float64
+	value1 := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 60), big.NewInt(1))
+	value2, _ := new(big.Int).SetString("123456789012345678901234567", 10)
+	chain.send(t, issuerKey, &token, new(big.Int), transferData(holder1, value1))
+	chain.send(t, issuerKey, &token, new(big.Int), transferData(holder2, value2))
+
+	chain.send(t, investorKey, &crowdsale, ether(1), nil)
+	secondContribution := uint64(len(chain.blocks))
+	chain.send(t, investorKey, &crowdsale, ether(2), nil)
+	chain.send(t, investorKey, &other, ether(3), nil)
+
+	explorer := NewJSONRPCExplorer(chain, nil)
+
+	tokenCount, issuingAddress, _, _, err := explorer.TokenCount(ctx, token.Hex(), 18, time.Unix(1000, 0))
+	if err != nil {
+		t.Fatalf("TokenCount: %v", err)
+	}
+	if want := new(big.Int).Add(value1, value2); tokenCount.Cmp(want) != 0 {
+		t.Errorf("TokenCount returned %v tokens, want %v", tokenCount, want)
+	}
+	if got, want := types.NewAmount(tokenCount, 18).String(), "123456790.165267183508081544"; got != want {
+		t.Errorf("TokenCount returned %s tokens, want %s", got, want)
+	}
+	if common.HexToAddress(issuingAddress) != issuer {
+		t.Errorf("TokenCount returned issuing address %s, want %s", issuingAddress, issuer.Hex())
+	}
+
+	balance, txnCount, err := explorer.CrowdSaleBalance(ctx, crowdsale.Hex())
+	if err != nil {
+		t.Fatalf("CrowdSaleBalance: %v", err)
+	}
+	if balance.Cmp(ether(3)) != 0 || txnCount != 2 {
+		t.Errorf("CrowdSaleBalance returned %v wei in %d transactions, want %v wei in 2", balance, txnCount, ether(3))
+	}
+
+	fundAddress, ethBalance, err := explorer.EthBalance(ctx, crowdsale.Hex())
+	if err != nil {
+		t.Fatalf("EthBalance: %v", err)
+	}
+	if common.HexToAddress(fundAddress) != crowdsale || ethBalance.Cmp(ether(3)) != 0 {
+		t.Errorf("EthBalance returned %v wei of %s, want %v wei of %s", ethBalance, fundAddress, ether(3), crowdsale.Hex())
+	}
+
+	explorer = NewJSONRPCExplorer(chain, nil)
+	explorer.FromBlock = secondContribution
+	contributions, err := explorer.CrowdSaleContributions(ctx, crowdsale.Hex())
+	if err != nil {
+		t.Fatalf("CrowdSaleContributions: %v", err)
+	}
+	if len(contributions) != 1 || contributions[0].Value.Cmp(ether(2)) != 0 {
+		t.Errorf("CrowdSaleContributions from block %d returned %v, want single contribution of %v wei", secondContribution, contributions, ether(2))
+	}
+
+	// outflows reuse transfers of the block scan done for contributions
+	outflows, err := explorer.Outflows(ctx, []string{strings.ToLower(investor.Hex())})
+	if err != nil {
+		t.Fatalf("Outflows: %v", err)
+	}
+	sent := outflows[strings.ToLower(investor.Hex())]
+	if len(sent) != 2 || sent[0].Value.Cmp(ether(2)) != 0 || sent[1].Value.Cmp(ether(3)) != 0 {
+		t.Fatalf("Outflows from block %d returned %v, want transfers of %v and %v wei", secondContribution, sent, ether(2), ether(3))
+	}
+	if sent[1].To != strings.ToLower(other.Hex()) || sent[1].Time != int64(secondContribution+1)*10 {
+		t.Errorf("Outflows returned transfer to %s at %d, want to %s at %d", sent[1].To, sent[1].Time, strings.ToLower(other.Hex()), (secondContribution+1)*10)
+	}
+}
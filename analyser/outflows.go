@@ -0,0 +1,213 @@
+package analyser
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+const (
+	// AddressKindExchange is known exchange address or deposit address forwarding funds to it
+	AddressKindExchange = "exchange"
+	// AddressKindContract is contract address
+	AddressKindContract = "contract"
+	// AddressKindFreshEOA is externally owned address without any transactions before it received funds
+	AddressKindFreshEOA = "fresh_eoa"
+	// AddressKindEOA is externally owned address with earlier history
+	AddressKindEOA = "eoa"
+
+	// maxTracedDestinations is number of the largest destinations followed to the second hop
+	maxTracedDestinations = 10
+	outflowWindow         = 30 * secondsPerDay
+)
+
+// DefaultExchanges are well-known hot wallets of exchanges, addresses are lower case
+var DefaultExchanges = map[string]string{
+	"0x3f5ce5fbfe3e9af3971dd833d26ba9b5c936f0be": "Binance",
+	"0xd551234ae421e3bcba99a0da6d736074f22192ff": "Binance",
+	"0x564286362092d8e7936f0549571a803b203aaced": "Binance",
+	"0xfbb1b73c4f0bda4f67dca266ce6ef42f520fbb98": "Bittrex",
+	"0x32be343b94f860124dc4fee278fdcbd38c102d88": "Poloniex",
+	"0x2910543af39aba0cd09dbb2d50200b3e800a63d2": "Kraken",
+	"0x1151314c646ce4e0efd76d1af4760ae66a9fe30f": "Bitfinex",
+	"0xd24400ae8bfebb18ca49be86258a3c749cf46853": "Gemini",
+}
+
+// Outflow is ETH sent by the address
+type Outflow struct {
+	To          string
+	BlockNumber uint64
+	// Time is unix timestamp of the block
+	Time int64
+	// Value is sent amount in wei
+	Value *big.Int
+}
+
+// OutflowExplorer is chain explorer which traces ETH sent by addresses
+type OutflowExplorer interface {
+	// Outflows returns ETH sent by every address, internal transactions included, addresses are lower case
+	Outflows(ctx context.Context, addresses []string) (outflows map[string][]Outflow, err error)
+	// IsContract returns true if there is contract code at the address
+	IsContract(ctx context.Context, address string) (bool, error)
+	// IsFresh returns true if the address had no transactions and no balance before the block
+	IsFresh(ctx context.Context, address string, blockNumber uint64) (bool, error)
+}
+
+// ReadExchanges reads known exchange addresses from CSV file with address and label columns
+func ReadExchanges(path string) (exchanges map[string]string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	exchanges = make(map[string]string)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !common.IsHexAddress(record[0]) {
+			continue
+		}
+
+		label := "exchange"
+		if len(record) > 1 {
+			label = record[1]
+		}
+		exchanges[strings.ToLower(record[0])] = label
+	}
+	return
+}
+
+// traceOutflows follows ETH sent by the fund address for two hops, nil is returned when chain explorer can't trace outflows
+func (a *Analyser) traceOutflows(ctx context.Context, fundAddress string, icoEndDate time.Time) (total types.Amount, data *types.OutflowData, err error) {
+	explorer, ok := a.Explorer.(OutflowExplorer)
+	if !ok || fundAddress == "" {
+		return
+	}
+
+	fundAddress = strings.ToLower(fundAddress)
+	hop1, err := explorer.Outflows(ctx, []string{fundAddress})
+	if err == errNotSupported {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	exchanges := a.Exchanges
+	if exchanges == nil {
+		exchanges = DefaultExchanges
+	}
+
+	data = new(types.OutflowData)
+	destinations := make(map[string]*types.OutflowDestination)
+	firstBlocks := make(map[string]uint64)
+	windowStart := icoEndDate.Unix()
+	windowEnd := windowStart + outflowWindow
+	for _, o := range hop1[fundAddress] {
+		value := types.NewAmount(o.Value, weiDecimals)
+		total = total.Add(value)
+		if o.Time >= windowStart && o.Time <= windowEnd {
+			data.Within30Days = data.Within30Days.Add(value)
+		}
+
+		d, ok := destinations[o.To]
+		if !ok {
+			d = &types.OutflowDestination{Address: o.To, FirstTransfer: time.Unix(o.Time, 0).UTC().Format(dateLayout)}
+			destinations[o.To] = d
+			firstBlocks[o.To] = o.BlockNumber
+		}
+		d.Eth = d.Eth.Add(value)
+	}
+
+	sorted := make([]*types.OutflowDestination, 0, len(destinations))
+	for _, d := range destinations {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Eth.Cmp(sorted[j].Eth) > 0 })
+
+	var traced []string
+	for i, d := range sorted {
+		if label, ok := exchanges[d.Address]; ok {
+			d.Kind, d.Label = AddressKindExchange, label
+			continue
+		}
+
+		isContract, err := explorer.IsContract(ctx, d.Address)
+		if err != nil {
+			return types.Amount{}, nil, err
+		}
+		if isContract {
+			d.Kind = AddressKindContract
+			continue
+		}
+
+		isFresh, err := explorer.IsFresh(ctx, d.Address, firstBlocks[d.Address])
+		if err != nil {
+			return types.Amount{}, nil, err
+		}
+		d.Kind = AddressKindEOA
+		if isFresh {
+			d.Kind = AddressKindFreshEOA
+		}
+		if i < maxTracedDestinations {
+			traced = append(traced, d.Address)
+		}
+	}
+
+	if len(traced) > 0 {
+		hop2, err := explorer.Outflows(ctx, traced)
+		if err != nil {
+			return types.Amount{}, nil, err
+		}
+		for _, address := range traced {
+			d := destinations[address]
+			for _, o := range hop2[address] {
+				value := types.NewAmount(o.Value, weiDecimals)
+				d.ForwardedEth = d.ForwardedEth.Add(value)
+				if _, ok := exchanges[o.To]; ok {
+					d.ForwardedToExchanges = d.ForwardedToExchanges.Add(value)
+				}
+			}
+			// fresh address which forwards funds to exchange is exchange deposit address
+			if d.Kind == AddressKindFreshEOA && d.ForwardedToExchanges.Sign() > 0 {
+				d.Kind, d.Label = AddressKindExchange, "deposit"
+			}
+		}
+	}
+
+	for i, d := range sorted {
+		switch d.Kind {
+		case AddressKindExchange:
+			data.ToExchanges = data.ToExchanges.Add(d.Eth)
+		case AddressKindContract:
+			data.ToContracts = data.ToContracts.Add(d.Eth)
+		case AddressKindFreshEOA:
+			data.ToFreshEoas = data.ToFreshEoas.Add(d.Eth)
+		default:
+			data.ToOtherEoas = data.ToOtherEoas.Add(d.Eth)
+		}
+		if i < maxTracedDestinations {
+			data.Destinations = append(data.Destinations, *d)
+		}
+	}
+	return
+}
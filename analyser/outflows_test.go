@@ -0,0 +1,55 @@
+package analyser
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// outflowsExplorer returns the given outflows, destinations are neither contracts nor fresh addresses
+type outflowsExplorer struct {
+	ChainExplorer
+	outflows map[string][]Outflow
+}
+
+func (e *outflowsExplorer) Outflows(ctx context.Context, addresses []string) (map[string][]Outflow, error) {
+	return e.outflows, nil
+}
+
+func (e *outflowsExplorer) IsContract(ctx context.Context, address string) (bool, error) {
+	return false, nil
+}
+
+func (e *outflowsExplorer) IsFresh(ctx context.Context, address string, blockNumber uint64) (bool, error) {
+	return false, nil
+}
+
+func TestTraceOutflowsWithin30Days(t *testing.T) {
+	const (
+		fund        = "0x00000000000000000000000000000000000000f0"
+		destination = "0x00000000000000000000000000000000000000d0"
+	)
+	icoEndDate := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	day := int64(secondsPerDay)
+
+	a := &Analyser{Explorer: &outflowsExplorer{outflows: map[string][]Outflow{
+		fund: {
+			{To: destination, BlockNumber: 1, Time: icoEndDate.Unix() - day, Value: ether(1)},
+			{To: destination, BlockNumber: 2, Time: icoEndDate.Unix(), Value: ether(2)},
+			{To: destination, BlockNumber: 3, Time: icoEndDate.Unix() + 30*day, Value: ether(4)},
+			{To: destination, BlockNumber: 4, Time: icoEndDate.Unix() + 31*day, Value: ether(8)},
+		},
+	}}}
+
+	total, data, err := a.traceOutflows(context.Background(), fund, icoEndDate)
+	if err != nil {
+		t.Fatalf("traceOutflows: %v", err)
+	}
+	if got, want := total.String(), "15"; got != want {
+		t.Errorf("traceOutflows returned total %s ETH, want %s", got, want)
+	}
+	// outflows before the ICO end date are not within 30 days after it
+	if got, want := data.Within30Days.String(), "6"; got != want {
+		t.Errorf("traceOutflows returned %s ETH within 30 days, want %s", got, want)
+	}
+}
@@ -0,0 +1,342 @@
+package analyser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+const (
+	// StageICOInfo fetches claimed funds raised, ICO price and dates from ICO metadata source
+	StageICOInfo = "ico_info"
+	// StageTokenCount reads token metadata and counts tokens distributed by the token issuing address
+	StageTokenCount = "token_count"
+	// StageEthRates fetches ETH/USD rates and normalises ICO info to ReportingCurrency
+	StageEthRates = "eth_rates"
+	// StageFundBalance reads ETH received and held by the fund address and traces its outflows
+	StageFundBalance = "fund_balance"
+	// StageChecks values funds raised and runs the checks
+	StageChecks = "checks"
+	// StageMetrics computes token holder metrics and the trust score
+	StageMetrics = "metrics"
+)
+
+// Stages are names of the analysis stages in the order they are run
+var Stages = []string{StageICOInfo, StageTokenCount, StageEthRates, StageFundBalance, StageChecks, StageMetrics}
+
+// Options select stages of the analysis, data of stages which are not run is taken from the passport
+type Options struct {
+	// Stages are run even when the passport supplies their data, all other stages are skipped;
+	// when empty, every stage whose data isn't supplied by the passport is run
+	Stages []string
+	// Skip are stages which are not run
+	Skip []string
+}
+
+// analysis is state shared by the stages
+type analysis struct {
+	data    *types.ICOPassport
+	icoInfo types.ICORatingData
+	result  types.CalculatedData
+
+	icoStartDate time.Time
+	icoEndDate   time.Time
+	// ethRates is rates series quoted by eth_rates stage, it's reused to value contributions
+	ethRates []RatePoint
+	// contributions are listed by fund_balance stage, they are not kept in the passport
+	contributions []Contribution
+	// contributionsLoaded is set when fund_balance stage runs, otherwise the contribution window check
+	// of the passport is kept
+	contributionsLoaded bool
+}
+
+type stage struct {
+	name string
+	run  func(a *Analyser, ctx context.Context, s *analysis) error
+	// supplied returns true when the passport already has data of the stage
+	supplied func(s *analysis) bool
+	// load prepares state from the passport when the stage is not run
+	load func(s *analysis) error
+}
+
+var pipeline = []stage{
+	{name: StageICOInfo, run: (*Analyser).fetchICOInfo, supplied: isReanalysis, load: loadICODates},
+	{name: StageTokenCount, run: (*Analyser).countTokens, supplied: isReanalysis},
+	{name: StageEthRates, run: (*Analyser).fetchEthRates, supplied: never},
+	{name: StageFundBalance, run: (*Analyser).readFundBalance, supplied: hasFundData, load: loadFundAddress},
+	{name: StageChecks, run: (*Analyser).runChecks, supplied: never},
+	{name: StageMetrics, run: (*Analyser).computeMetrics, supplied: never},
+}
+
+// RunStages runs the analysis stages selected by options
+func (a *Analyser) RunStages(ctx context.Context, data *types.ICOPassport, opts Options) (analysedData types.CalculatedData, icoRatingData types.ICORatingData, err error) {
+	run, err := selectStages(opts)
+	if err != nil {
+		return data.CalculatedData, data.IcoInfo, newError(ReasonInvalidInput, err)
+	}
+
+	s := &analysis{
+		data:    data,
+		icoInfo: data.IcoInfo,
+		result:  data.CalculatedData,
+	}
+	for _, st := range pipeline {
+		selected, ok := run[st.name]
+		if !ok {
+			selected = !st.supplied(s)
+		}
+
+		if selected {
+			err = st.run(a, ctx, s)
+		} else if st.load != nil {
+			err = st.load(s)
+		}
+		if err != nil {
+			return s.result, s.icoInfo, err
+		}
+	}
+	return s.result, s.icoInfo, nil
+}
+
+// ParseStages parses comma separated list of stage names, empty list is returned for empty string
+func ParseStages(list string) (stages []string, err error) {
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !isStage(name) {
+			return nil, fmt.Errorf("unknown analysis stage %q", name)
+		}
+		stages = append(stages, name)
+	}
+	return
+}
+
+func isStage(name string) bool {
+	for _, stage := range Stages {
+		if stage == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectStages returns stages forced to run (true) or to be skipped (false), other stages run unless supplied
+func selectStages(opts Options) (map[string]bool, error) {
+	run := make(map[string]bool, len(Stages))
+	if len(opts.Stages) > 0 {
+		for _, name := range Stages {
+			run[name] = false
+		}
+	}
+	for _, name := range opts.Stages {
+		if !isStage(name) {
+			return nil, fmt.Errorf("unknown analysis stage %q", name)
+		}
+		run[name] = true
+	}
+	for _, name := range opts.Skip {
+		if !isStage(name) {
+			return nil, fmt.Errorf("unknown analysis stage %q", name)
+		}
+		run[name] = false
+	}
+	return run, nil
+}
+
+func never(*analysis) bool { return false }
+
+// isReanalysis returns true for passports with data of the earlier analysis
+func isReanalysis(s *analysis) bool { return s.data.Metadata.Version != 0 }
+
+// hasFundData returns true when the earlier analysis read the fund address, it's re-read for separate crowdsale address
+func hasFundData(s *analysis) bool {
+	m := s.data.Metadata
+	return isReanalysis(s) && !(m.CrowdSaleAddress != "" && m.OwnerAddress != m.CrowdSaleAddress)
+}
+
+func loadICODates(s *analysis) (err error) {
+	if s.icoStartDate, err = time.Parse(dateLayout, s.icoInfo.IcoStartDate); err != nil {
+		return newError(ReasonInvalidInput, err)
+	}
+	if s.icoEndDate, err = time.Parse(dateLayout, s.icoInfo.IcoEndDate); err != nil {
+		return newError(ReasonInvalidInput, err)
+	}
+	return
+}
+
+func loadFundAddress(s *analysis) error {
+	if s.data.Metadata.FundAddress == "" {
+		resolveFundAddress(&s.data.Metadata)
+	}
+	return nil
+}
+
+// resolveFundAddress sets the fund address to the crowdsale address when it differs from the owner address
+func resolveFundAddress(metadata *types.ICOAnalyzerData) {
+	metadata.FundAddress = metadata.OwnerAddress
+	metadata.OwnerIsIcoWallet = true
+	if metadata.CrowdSaleAddress != "" && metadata.OwnerAddress != metadata.CrowdSaleAddress {
+		metadata.FundAddress = metadata.CrowdSaleAddress
+		metadata.OwnerIsIcoWallet = false
+	}
+}
+
+func (a *Analyser) fetchICOInfo(ctx context.Context, s *analysis) (err error) {
+	s.icoInfo, s.icoStartDate, s.icoEndDate, err = a.ICOInfo.ICOInfo(ctx, s.data.Metadata.IcoName)
+	return newError(ReasonICOInfoUnavailable, err)
+}
+
+func (a *Analyser) countTokens(ctx context.Context, s *analysis) error {
+	metadata := &s.data.Metadata
+	var warnings []string
+	s.result.Token, s.result.TokenTotalSupply, warnings = a.tokenInfo(ctx, metadata)
+	for _, w := range warnings {
+		addWarning(&s.result, w)
+	}
+
+	tokenCount, tokenIssuingAddress, tokenStartDate, tokenEndDate, err := a.Explorer.TokenCount(ctx, strings.ToLower(metadata.TokenContractAddress), metadata.Decimals, s.icoEndDate)
+	if err != nil {
+		return newError(ReasonChainDataUnavailable, err)
+	}
+	metadata.TokenIssuerAddress = tokenIssuingAddress
+	metadata.Confidence = 0.1
+
+	s.result.TokensIssued = types.NewAmount(tokenCount, metadata.Decimals)
+	s.result.Metrics.DistributionStartFromIcoStart = tokenStartDate
+	s.result.Metrics.DistributionEndFromIcoEnd = tokenEndDate
+	return nil
+}
+
+func (a *Analyser) fetchEthRates(ctx context.Context, s *analysis) error {
+	quote, err := quoteEthRates(ctx, a.Prices, s.icoStartDate.Unix(), s.icoEndDate.Unix())
+	if err != nil {
+		return newError(ReasonPriceDataUnavailable, err)
+	}
+
+	cfr, icoPrice, err := a.normaliseICOInfo(ctx, s.icoInfo, s.icoStartDate, s.icoEndDate, quote.StartRate, quote.EndRate)
+	if err != nil {
+		return err
+	}
+
+	s.ethRates = quote.Series
+
+	r := &s.result
+	r.EthRateSource = quote.Source
+	r.EthRateSpread = quote.Spread
+	r.EthRateStart = quote.StartRate
+	r.EthRateEnd = quote.EndRate
+	r.ReportingCurrency = ReportingCurrency
+	r.CfrReporting = cfr
+	r.IcoPriceReporting = icoPrice
+	if rateChange, ok := ratio(quote.EndRate, quote.StartRate); ok {
+		s.icoInfo.IcoPriceAdjusted = s.icoInfo.IcoPrice * rateChange
+		r.IcoPriceAdjustedReporting = icoPrice * rateChange
+	}
+	return nil
+}
+
+func (a *Analyser) readFundBalance(ctx context.Context, s *analysis) error {
+	metadata := &s.data.Metadata
+	resolveFundAddress(metadata)
+	metadata.EthNominated = true
+	metadata.TokenTxInputAdjustment = false
+	s.contributionsLoaded = true
+	if metadata.FundAddress == "" {
+		log.Printf("warning: neither owner nor crowdsale address is given, fund balance is not read")
+		return nil
+	}
+
+	crowdSaleBalance, txnCount, contributions, err := a.crowdSale(ctx, strings.ToLower(metadata.FundAddress))
+	if err != nil {
+		return newError(ReasonChainDataUnavailable, err)
+	}
+
+	fundAddress, ethBalance, err := a.Explorer.EthBalance(ctx, strings.ToLower(metadata.FundAddress))
+	if err != nil {
+		return newError(ReasonChainDataUnavailable, err)
+	}
+	metadata.FundAddress = fundAddress
+
+	ethOut, outflows, err := a.traceOutflows(ctx, fundAddress, s.icoEndDate)
+	if err != nil {
+		return newError(ReasonChainDataUnavailable, err)
+	}
+
+	r := &s.result
+	r.Metrics.FundsBalanceEth = types.NewAmount(ethBalance, weiDecimals)
+	r.IcoEthIn = types.NewAmount(crowdSaleBalance, weiDecimals)
+	r.IcoEthOut = ethOut
+	r.Outflows = outflows
+	r.IcoEthTotal = txnCount
+	s.contributions = contributions
+
+	r.EfrIcoTxTimeWeighted, err = timeWeightedEfr(s.ethRates, contributions)
+	if err == nil && len(contributions) == 0 && txnCount > 0 {
+		err = errors.New("contributions are not listed by the chain explorer")
+	}
+	if err != nil {
+		log.Printf("warning: time-weighted ETH rate is not calculated: %v", err)
+		addWarning(r, "time-weighted funds raised are not calculated: "+err.Error())
+	}
+	return nil
+}
+
+// addWarning records the warning unless the result already has it
+func addWarning(r *types.CalculatedData, warning string) {
+	for _, w := range r.Warnings {
+		if w == warning {
+			return
+		}
+	}
+	r.Warnings = append(r.Warnings, warning)
+}
+
+func (a *Analyser) runChecks(ctx context.Context, s *analysis) error {
+	r := &s.result
+	metadata := s.data.Metadata
+	cfr, icoPrice := r.CfrReporting, r.IcoPriceReporting
+	endDateEthRate := math.Max(r.EthRateEnd, r.EthRateStart)
+	ethPriceFluctuation := math.Max(math.Abs((r.EthRateEnd-r.EthRateStart)/r.EthRateStart), metadata.Confidence)
+
+	r.EfrToken = r.TokensIssued.Float64() * icoPrice
+	r.EfrTokenAdjusted = r.TokensIssued.Float64() * r.IcoPriceAdjustedReporting
+	r.TokenCheckResult.FundsRaisedAdjustedDiff, _ = ratio(r.EfrTokenAdjusted-cfr, cfr)
+	r.TokenCheckResult.FundsRaisedResult = fundsRaisedCheck(r.EfrToken, cfr, ethPriceFluctuation)
+
+	r.EfrIcoTx = r.IcoEthIn.Float64() * endDateEthRate
+	r.EfrOwnerTxCurrency = ReportingCurrency
+	r.IcoWalletCheckResult = fundsRaisedCheck(r.EfrIcoTx, cfr, ethPriceFluctuation)
+	if metadata.FundAddress == "" {
+		r.IcoWalletCheckResult = types.FundsRaisedResult{FundsRaisedCheck: types.CheckSkipped, Reason: "neither owner nor crowdsale address is given"}
+	}
+
+	r.CapCheckResult = a.capCheck(ctx, metadata, s.icoInfo, r, s.icoEndDate, endDateEthRate, ethPriceFluctuation)
+	if s.contributionsLoaded {
+		r.ContributionWindowCheckResult = contributionWindowCheck(s.contributions, r.IcoEthTotal, s.icoStartDate, s.icoEndDate)
+	}
+	r.DistributionStartCheckResult = distributionStartCheck(r.Metrics.DistributionStartFromIcoStart, s.icoStartDate)
+	return nil
+}
+
+func (a *Analyser) computeMetrics(ctx context.Context, s *analysis) error {
+	r := &s.result
+	metadata := s.data.Metadata
+	holders, err := a.holderDistribution(ctx, metadata.TokenContractAddress, metadata.TokenIssuerAddress, metadata.OwnerAddress)
+	if err != nil {
+		// holder distribution is a metric only, the analysis goes on without it
+		log.Printf("warning: token holder distribution is not calculated: %v", err)
+		addWarning(r, "token holder distribution is not calculated: "+err.Error())
+	}
+	r.Metrics.Holders = holders
+
+	r.Metrics.DistributionDays = s.icoEndDate.Sub(s.icoStartDate).Hours() / 24
+	r.TrustScore = a.trustScore(r, s.icoStartDate, s.icoEndDate)
+	return nil
+}
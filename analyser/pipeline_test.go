@@ -0,0 +1,123 @@
+package analyser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+func TestParseStages(t *testing.T) {
+	stages, err := ParseStages(" eth_rates, ,checks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{StageEthRates, StageChecks}; !reflect.DeepEqual(stages, want) {
+		t.Errorf("ParseStages returned %v, want %v", stages, want)
+	}
+
+	if stages, err = ParseStages(""); err != nil || len(stages) != 0 {
+		t.Errorf("ParseStages of empty list returned %v, %v, want no stages", stages, err)
+	}
+	if _, err = ParseStages("eth_rates,prices"); err == nil {
+		t.Error("ParseStages of unknown stage succeeded, want error")
+	}
+}
+
+func TestSelectStages(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]bool
+	}{
+		{"default", Options{}, map[string]bool{}},
+		{"skip", Options{Skip: []string{StageMetrics}}, map[string]bool{StageMetrics: false}},
+		{
+			"sections",
+			Options{Stages: []string{StageFundBalance, StageChecks}, Skip: []string{StageChecks}},
+			map[string]bool{
+				StageICOInfo:     false,
+				StageTokenCount:  false,
+				StageEthRates:    false,
+				StageFundBalance: true,
+				StageChecks:      false,
+				StageMetrics:     false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := selectStages(tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: selectStages returned %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := selectStages(Options{Stages: []string{"prices"}}); err == nil {
+		t.Error("selectStages with unknown stage succeeded, want error")
+	}
+}
+
+func TestRunStagesKeepsContributionWindowCheck(t *testing.T) {
+	windowCheck := types.ComplianceCheck{Result: types.CheckFailed, Reason: "contributions arrived outside ICO dates"}
+	data := &types.ICOPassport{}
+	data.Metadata.Version = 1
+	data.IcoInfo.IcoStartDate = "01 Mar 2018"
+	data.IcoInfo.IcoEndDate = "31 Mar 2018"
+	data.CalculatedData.ContributionWindowCheckResult = windowCheck
+	data.CalculatedData.Warnings = []string{"token metadata is not available"}
+
+	// only checks are re-run, contributions are not listed, so the earlier result of the window check is kept
+	a := &Analyser{}
+	result, _, err := a.RunStages(context.Background(), data, Options{Stages: []string{StageChecks}})
+	if err != nil {
+		t.Fatalf("RunStages: %v", err)
+	}
+	if !reflect.DeepEqual(result.ContributionWindowCheckResult, windowCheck) {
+		t.Errorf("RunStages returned contribution window check %+v, want %+v", result.ContributionWindowCheckResult, windowCheck)
+	}
+	if want := []string{"token metadata is not available"}; !reflect.DeepEqual(result.Warnings, want) {
+		t.Errorf("RunStages returned warnings %v, want %v", result.Warnings, want)
+	}
+	if result.CapCheckResult.Result != types.CheckInconclusive {
+		t.Errorf("RunStages returned cap check %+v, want inconclusive check", result.CapCheckResult)
+	}
+}
+
+// transfersExplorer fails listing token transfers
+type transfersExplorer struct {
+	ChainExplorer
+}
+
+func (e *transfersExplorer) TokenTransfers(ctx context.Context, tokenAddress string) ([]TokenTransfer, error) {
+	return nil, errors.New("etherscan: NOTOK: Result window is too large")
+}
+
+func TestRunStagesWarnsOfHolderDistribution(t *testing.T) {
+	data := &types.ICOPassport{}
+	data.Metadata.Version = 1
+	data.Metadata.TokenContractAddress = "0x00000000000000000000000000000000000000cc"
+	data.IcoInfo.IcoStartDate = "01 Mar 2018"
+	data.IcoInfo.IcoEndDate = "31 Mar 2018"
+
+	a := &Analyser{Explorer: &transfersExplorer{}}
+	result, _, err := a.RunStages(context.Background(), data, Options{Stages: []string{StageMetrics}})
+	if err != nil {
+		t.Fatalf("RunStages: %v", err)
+	}
+	if result.Metrics.Holders != nil {
+		t.Errorf("RunStages returned holders %+v, want none", result.Metrics.Holders)
+	}
+	if want := []string{"token holder distribution is not calculated: etherscan: NOTOK: Result window is too large"}; !reflect.DeepEqual(result.Warnings, want) {
+		t.Errorf("RunStages returned warnings %v, want %v", result.Warnings, want)
+	}
+	if result.TrustScore == nil {
+		t.Error("RunStages returned no trust score")
+	}
+}
@@ -1,9 +1,10 @@
 package analyser
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 
 	"github.com/monetha/ico-analyzer/types"
@@ -11,24 +12,79 @@ import (
 
 const poloniexURL = "https://poloniex.com/public?command=returnChartData&currencyPair=USDT_ETH&start=%d&end=%d&period=7200"
 
-func getEthRateFromPoloneix(startDate, endDate int64) (startDateRate, endDateRate float64, err error) {
-	resp, err := http.Get(fmt.Sprintf(poloniexURL, startDate, endDate))
+// Poloniex fetches ETH/USD rates from poloniex.com chart data
+type Poloniex struct {
+	// Client is HTTP client used for requests, http.DefaultClient is used when nil
+	Client *http.Client
+}
+
+// NewPoloniex creates price oracle backed by poloniex.com
+func NewPoloniex() *Poloniex {
+	return &Poloniex{}
+}
+
+// EthRates implements PriceOracle interface
+func (p *Poloniex) EthRates(ctx context.Context, startDate, endDate int64) (startDateRate, endDateRate float64, err error) {
+	ethRatesData, err := p.candles(ctx, startDate, endDate)
 	if err != nil {
 		return
 	}
 
-	poloniexData, err := ioutil.ReadAll(resp.Body)
+	startDateRate = ethRatesData[0].WeightedAverage
+	endDateRate = ethRatesData[len(ethRatesData)-1].WeightedAverage
+	return
+}
+
+// EthRateSeries implements RateSeriesOracle interface
+func (p *Poloniex) EthRateSeries(ctx context.Context, startDate, endDate int64) (series []RatePoint, err error) {
+	ethRatesData, err := p.candles(ctx, startDate, endDate)
+	if err != nil {
+		return
+	}
+	return candleSeries(ethRatesData), nil
+}
+
+// EthRateQuote implements QuotingPriceOracle interface, rates and series come from the same candles
+func (p *Poloniex) EthRateQuote(ctx context.Context, startDate, endDate int64) (quote EthRateQuote, err error) {
+	ethRatesData, err := p.candles(ctx, startDate, endDate)
+	if err != nil {
+		return
+	}
+
+	quote.StartRate = ethRatesData[0].WeightedAverage
+	quote.EndRate = ethRatesData[len(ethRatesData)-1].WeightedAverage
+	quote.Source = p.Name()
+	quote.Series = candleSeries(ethRatesData)
+	return
+}
+
+func candleSeries(ethRatesData []types.PoloniexData) []RatePoint {
+	series := make([]RatePoint, len(ethRatesData))
+	for i, candle := range ethRatesData {
+		series[i] = RatePoint{Time: int64(candle.Date), Rate: candle.WeightedAverage}
+	}
+	return series
+}
+
+// candles returns 2-hour candles of the period, at least one candle is returned
+func (p *Poloniex) candles(ctx context.Context, startDate, endDate int64) (ethRatesData []types.PoloniexData, err error) {
+	poloniexData, err := httpGet(ctx, p.Client, fmt.Sprintf(poloniexURL, startDate, endDate))
 	if err != nil {
 		return
 	}
 
-	var ethRatesData []types.PoloniexData
 	err = json.Unmarshal(poloniexData, &ethRatesData)
 	if err != nil {
 		return
 	}
 
-	startDateRate = ethRatesData[0].WeightedAverage
-	endDateRate = ethRatesData[len(ethRatesData)-1].WeightedAverage
+	if len(ethRatesData) == 0 {
+		err = &Error{Reason: ReasonPriceDataMissing, Err: errors.New("no ETH rates returned by poloniex")}
+	}
 	return
 }
+
+// Name returns name of the price source
+func (p *Poloniex) Name() string {
+	return "poloniex"
+}
@@ -0,0 +1,124 @@
+package analyser
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+)
+
+// EthRateQuote is ETH/USD rates of the period together with the source they come from
+type EthRateQuote struct {
+	StartRate float64
+	EndRate   float64
+	// Source is name of the price source which produced the rates
+	Source string
+	// Spread is the largest relative difference between rates of the aggregated sources
+	Spread float64
+	// Series is rates of the period sorted by time, it's empty when the source provides only start and end rates
+	Series []RatePoint
+}
+
+// QuotingPriceOracle is price oracle which reports the source of the rates
+type QuotingPriceOracle interface {
+	EthRateQuote(ctx context.Context, startDate, endDate int64) (EthRateQuote, error)
+}
+
+// quoteEthRates gets rates from the oracle, the oracle name is used as the source when it doesn't quote them itself
+func quoteEthRates(ctx context.Context, oracle PriceOracle, startDate, endDate int64) (quote EthRateQuote, err error) {
+	if q, ok := oracle.(QuotingPriceOracle); ok {
+		return q.EthRateQuote(ctx, startDate, endDate)
+	}
+
+	quote.StartRate, quote.EndRate, err = oracle.EthRates(ctx, startDate, endDate)
+	if n, ok := oracle.(interface{ Name() string }); ok {
+		quote.Source = n.Name()
+	}
+	return
+}
+
+// MedianPrices is price oracle which queries all oracles and takes median of their rates,
+// failing oracles are skipped
+type MedianPrices []PriceOracle
+
+// EthRates implements PriceOracle interface
+func (m MedianPrices) EthRates(ctx context.Context, startDate, endDate int64) (startDateRate, endDateRate float64, err error) {
+	quote, err := m.EthRateQuote(ctx, startDate, endDate)
+	return quote.StartRate, quote.EndRate, err
+}
+
+// EthRateQuote implements QuotingPriceOracle interface
+func (m MedianPrices) EthRateQuote(ctx context.Context, startDate, endDate int64) (quote EthRateQuote, err error) {
+	var (
+		startRates, endRates []float64
+		sources              []string
+	)
+
+	err = errNoSources
+	for _, oracle := range m {
+		q, qErr := quoteEthRates(ctx, oracle, startDate, endDate)
+		if qErr != nil {
+			err = qErr
+			continue
+		}
+		startRates = append(startRates, q.StartRate)
+		endRates = append(endRates, q.EndRate)
+		sources = append(sources, q.Source)
+		if len(quote.Series) == 0 {
+			// series of the first source which provides it is used, like EthRateSeries does
+			quote.Series = q.Series
+		}
+	}
+	if len(sources) == 0 {
+		return
+	}
+	err = nil
+
+	quote.StartRate = median(startRates)
+	quote.EndRate = median(endRates)
+	quote.Spread = math.Max(spread(startRates, quote.StartRate), spread(endRates, quote.EndRate))
+	quote.Source = sources[0]
+	if len(sources) > 1 {
+		quote.Source = "median(" + strings.Join(sources, ",") + ")"
+	}
+	return
+}
+
+// EthRateSeries implements RateSeriesOracle interface, series of the first oracle which provides it is used
+func (m MedianPrices) EthRateSeries(ctx context.Context, startDate, endDate int64) (series []RatePoint, err error) {
+	return firstRateSeries(ctx, m, startDate, endDate)
+}
+
+// rateAt returns the latest rate of the series at the time, the first rate is used for earlier times
+func rateAt(series []RatePoint, t int64) float64 {
+	i := sort.Search(len(series), func(i int) bool { return series[i].Time > t })
+	if i > 0 {
+		i--
+	}
+	return series[i].Rate
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// spread returns difference between the highest and the lowest value relative to the median
+func spread(values []float64, median float64) float64 {
+	if median == 0 {
+		return 0
+	}
+
+	min, max := values[0], values[0]
+	for _, v := range values[1:] {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	return (max - min) / median
+}
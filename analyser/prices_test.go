@@ -0,0 +1,124 @@
+package analyser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// stubPrices is price oracle quoting the given rates and series, it fails with err when it's set
+type stubPrices struct {
+	name       string
+	start, end float64
+	series     []RatePoint
+	err        error
+}
+
+func (p *stubPrices) EthRates(ctx context.Context, startDate, endDate int64) (float64, float64, error) {
+	return p.start, p.end, p.err
+}
+
+func (p *stubPrices) EthRateQuote(ctx context.Context, startDate, endDate int64) (EthRateQuote, error) {
+	if p.err != nil {
+		return EthRateQuote{}, p.err
+	}
+	return EthRateQuote{StartRate: p.start, EndRate: p.end, Source: p.name, Series: p.series}, nil
+}
+
+func (p *stubPrices) EthRateSeries(ctx context.Context, startDate, endDate int64) ([]RatePoint, error) {
+	return p.series, p.err
+}
+
+func TestMedianPrices(t *testing.T) {
+	errUnavailable := errors.New("source is unavailable")
+	var (
+		a      = &stubPrices{name: "a", start: 400, end: 500}
+		b      = &stubPrices{name: "b", start: 410, end: 520}
+		c      = &stubPrices{name: "c", start: 500, end: 600}
+		d      = &stubPrices{name: "d", start: 420, end: 540}
+		failed = &stubPrices{name: "failed", err: errUnavailable}
+	)
+
+	tests := []struct {
+		name    string
+		oracles MedianPrices
+		want    EthRateQuote
+		wantErr error
+	}{
+		{
+			name:    "odd number of sources",
+			oracles: MedianPrices{a, b, c},
+			want:    EthRateQuote{StartRate: 410, EndRate: 520, Source: "median(a,b,c)", Spread: 100.0 / 410},
+		},
+		{
+			name:    "even number of sources",
+			oracles: MedianPrices{a, b, c, d},
+			want:    EthRateQuote{StartRate: 415, EndRate: 530, Source: "median(a,b,c,d)", Spread: 100.0 / 415},
+		},
+		{
+			name:    "failing source is skipped",
+			oracles: MedianPrices{a, failed, d},
+			want:    EthRateQuote{StartRate: 410, EndRate: 520, Source: "median(a,d)", Spread: 40.0 / 520},
+		},
+		{
+			name:    "single source",
+			oracles: MedianPrices{failed, b},
+			want:    EthRateQuote{StartRate: 410, EndRate: 520, Source: "b"},
+		},
+		{
+			name:    "all sources fail",
+			oracles: MedianPrices{failed, failed},
+			wantErr: errUnavailable,
+		},
+		{
+			name:    "no sources",
+			wantErr: errNoSources,
+		},
+	}
+
+	for _, tt := range tests {
+		quote, err := tt.oracles.EthRateQuote(context.Background(), icoStart.Unix(), icoEnd.Unix())
+		if err != tt.wantErr {
+			t.Errorf("%s: EthRateQuote returned error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if quote.StartRate != tt.want.StartRate || quote.EndRate != tt.want.EndRate || quote.Source != tt.want.Source || !closeTo(quote.Spread, tt.want.Spread) {
+			t.Errorf("%s: EthRateQuote returned %+v, want %+v", tt.name, quote, tt.want)
+		}
+
+		start, end, err := tt.oracles.EthRates(context.Background(), icoStart.Unix(), icoEnd.Unix())
+		if err != nil || start != quote.StartRate || end != quote.EndRate {
+			t.Errorf("%s: EthRates returned %v, %v, %v, want rates of the quote", tt.name, start, end, err)
+		}
+	}
+}
+
+func TestMedianPricesSeriesFallback(t *testing.T) {
+	series := []RatePoint{{Time: icoStart.Unix(), Rate: 400}, {Time: icoEnd.Unix(), Rate: 500}}
+	oracles := MedianPrices{
+		&stubPrices{name: "empty", start: 400, end: 500, series: []RatePoint{}},
+		&stubPrices{name: "failed", series: []RatePoint{{Time: icoStart.Unix(), Rate: 1}}, err: errors.New("source is unavailable")},
+		&stubPrices{name: "series", start: 400, end: 500, series: series},
+	}
+
+	quote, err := oracles.EthRateQuote(context.Background(), icoStart.Unix(), icoEnd.Unix())
+	if err != nil {
+		t.Fatalf("EthRateQuote: %v", err)
+	}
+	if !reflect.DeepEqual(quote.Series, series) {
+		t.Errorf("EthRateQuote returned series %v, want %v", quote.Series, series)
+	}
+
+	got, err := oracles.EthRateSeries(context.Background(), icoStart.Unix(), icoEnd.Unix())
+	if err != nil || !reflect.DeepEqual(got, series) {
+		t.Errorf("EthRateSeries returned %v, %v, want %v", got, err, series)
+	}
+
+	if got, err = (MedianPrices{fixedPrices{400, 500}}).EthRateSeries(context.Background(), icoStart.Unix(), icoEnd.Unix()); err != errNotSupported {
+		t.Errorf("EthRateSeries of oracle without series returned %v, %v, want %v", got, err, errNotSupported)
+	}
+}
@@ -0,0 +1,216 @@
+package analyser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+const (
+	// FactorTokenFundsRaised scores deviation of funds raised derived from tokens issued from claimed funds raised
+	FactorTokenFundsRaised = "token_funds_raised"
+	// FactorWalletFundsRaised scores deviation of ETH received by the crowdsale from claimed funds raised
+	FactorWalletFundsRaised = "wallet_funds_raised"
+	// FactorDistributionDelay scores delay of token distribution start after ICO start
+	FactorDistributionDelay = "distribution_delay"
+	// FactorFundBalance scores share of raised ETH still held by the fund address
+	FactorFundBalance = "fund_balance"
+	// FactorHolderConcentration scores share of tokens held by the largest holders
+	FactorHolderConcentration = "holder_concentration"
+	// FactorCaps scores the soft and hard cap check
+	FactorCaps = "caps"
+	// FactorContributionWindow scores the contribution window check
+	FactorContributionWindow = "contribution_window"
+	// FactorDistributionStart scores the distribution start check
+	FactorDistributionStart = "distribution_start"
+
+	// maxScore is score of ICO with all factors fully satisfied
+	maxScore = 100
+	// distributionGraceDays is delay after ICO end which doesn't lower the distribution delay factor
+	distributionGraceDays = 30
+	// distributionMaxDelayDays is delay after the grace period which lowers the factor to zero
+	distributionMaxDelayDays = 150
+)
+
+// ScoreWeights are weights of trust score factors, factors without data are skipped and weights of the rest are scaled
+type ScoreWeights struct {
+	// Version identifies the weights the score was computed with
+	Version string             `json:"version"`
+	Factors map[string]float64 `json:"factors"`
+}
+
+// DefaultScoreWeights are used when no weights file is configured, they are the same as in score-weights.json
+var DefaultScoreWeights = &ScoreWeights{
+	Version: "2018-12.1",
+	Factors: map[string]float64{
+		FactorTokenFundsRaised:    20,
+		FactorWalletFundsRaised:   20,
+		FactorDistributionDelay:   10,
+		FactorFundBalance:         10,
+		FactorHolderConcentration: 15,
+		FactorCaps:                10,
+		FactorContributionWindow:  10,
+		FactorDistributionStart:   5,
+	},
+}
+
+var scoreFactors = []string{
+	FactorTokenFundsRaised,
+	FactorWalletFundsRaised,
+	FactorDistributionDelay,
+	FactorFundBalance,
+	FactorHolderConcentration,
+	FactorCaps,
+	FactorContributionWindow,
+	FactorDistributionStart,
+}
+
+// ReadScoreWeights reads trust score weights from JSON file
+func ReadScoreWeights(path string) (weights *ScoreWeights, err error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	weights = new(ScoreWeights)
+	if err = json.Unmarshal(raw, weights); err != nil {
+		return nil, err
+	}
+	if weights.Version == "" {
+		return nil, fmt.Errorf("%s: version is required", path)
+	}
+	var totalWeight float64
+	for name, weight := range weights.Factors {
+		if !isScoreFactor(name) {
+			return nil, fmt.Errorf("%s: unknown factor %s", path, name)
+		}
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("%s: invalid weight %v of factor %s", path, weight, name)
+		}
+		totalWeight += weight
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("%s: at least one factor must have positive weight", path)
+	}
+	return
+}
+
+func isScoreFactor(name string) bool {
+	for _, factor := range scoreFactors {
+		if factor == name {
+			return true
+		}
+	}
+	return false
+}
+
+// trustScore combines checks and metrics of the analysis into 0-100 score
+func (a *Analyser) trustScore(analysedData *types.CalculatedData, icoStartDate, icoEndDate time.Time) *types.TrustScore {
+	weights := a.ScoreWeights
+	if weights == nil {
+		weights = DefaultScoreWeights
+	}
+
+	values := map[string]float64{}
+	reasons := map[string]string{}
+	set := func(name string, value float64, ok bool, reason string) {
+		if ok && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			values[name] = math.Max(0, math.Min(1, value))
+		} else {
+			reasons[name] = reason
+		}
+	}
+
+	token, wallet := analysedData.TokenCheckResult.FundsRaisedResult, analysedData.IcoWalletCheckResult
+	set(FactorTokenFundsRaised, deviationValue(token.FundsRaisedDiff), isDecided(token.FundsRaisedCheck), "token check is "+string(token.FundsRaisedCheck))
+	set(FactorWalletFundsRaised, deviationValue(wallet.FundsRaisedDiff), isDecided(wallet.FundsRaisedCheck), "ICO wallet check is "+string(wallet.FundsRaisedCheck))
+
+	if distributionStart, err := time.Parse(dateLayout, analysedData.Metrics.DistributionStartFromIcoStart); err == nil {
+		set(FactorDistributionDelay, distributionDelayValue(distributionStart, icoStartDate, icoEndDate), true, "")
+	} else {
+		set(FactorDistributionDelay, 0, false, "token distribution start date is not known")
+	}
+
+	raised := analysedData.IcoEthIn.Float64()
+	set(FactorFundBalance, analysedData.Metrics.FundsBalanceEth.Float64()/raised, raised > 0, "ETH received by the crowdsale is not known")
+
+	holders := analysedData.Metrics.Holders
+	set(FactorHolderConcentration, 1-holdersShare(holders), holders != nil && holders.Holders > 0, "token holders are not known")
+
+	for name, check := range map[string]types.ComplianceCheck{
+		FactorCaps:               analysedData.CapCheckResult,
+		FactorContributionWindow: analysedData.ContributionWindowCheckResult,
+		FactorDistributionStart:  analysedData.DistributionStartCheckResult,
+	} {
+		set(name, checkValue(check.Result), isDecided(check.Result), "check is "+string(check.Result))
+	}
+
+	var totalWeight float64
+	for _, name := range scoreFactors {
+		if _, ok := values[name]; ok {
+			totalWeight += weights.Factors[name]
+		}
+	}
+
+	score := &types.TrustScore{WeightsVersion: weights.Version}
+	for _, name := range scoreFactors {
+		factor := types.ScoreFactor{Name: name, Weight: weights.Factors[name]}
+		if value, ok := values[name]; ok && totalWeight > 0 {
+			factor.Value = value
+			factor.Contribution = maxScore * value * factor.Weight / totalWeight
+			score.Score += factor.Contribution
+		} else {
+			factor.Skipped = true
+			factor.Reason = reasons[name]
+			if totalWeight == 0 && factor.Reason == "" {
+				factor.Reason = "no factors with weight"
+			}
+		}
+		score.Factors = append(score.Factors, factor)
+	}
+	return score
+}
+
+// deviationValue is 1 when funds raised are not below the claimed funds and decreases with the shortfall
+func deviationValue(diff float64) float64 {
+	if diff >= 0 {
+		return 1
+	}
+	return 1 + diff
+}
+
+// distributionDelayValue is 0 when distribution started before ICO, 1 until the grace period after ICO end
+// and decreases to 0 during distributionMaxDelayDays after it
+func distributionDelayValue(distributionStart, icoStartDate, icoEndDate time.Time) float64 {
+	if distributionStart.Before(icoStartDate) {
+		return 0
+	}
+	delayDays := distributionStart.Sub(icoEndDate).Hours()/24 - distributionGraceDays
+	if delayDays <= 0 {
+		return 1
+	}
+	return 1 - delayDays/distributionMaxDelayDays
+}
+
+func holdersShare(holders *types.HolderDistribution) float64 {
+	if holders == nil {
+		return 0
+	}
+	return holders.TopHoldersShare
+}
+
+func checkValue(status types.CheckStatus) float64 {
+	if status == types.CheckPassed {
+		return 1
+	}
+	return 0
+}
+
+// isDecided returns true for checks which passed or failed
+func isDecided(status types.CheckStatus) bool {
+	return status == types.CheckPassed || status == types.CheckFailed
+}
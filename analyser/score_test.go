@@ -0,0 +1,144 @@
+package analyser
+
+import (
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+func TestReadScoreWeights(t *testing.T) {
+	weights, err := ReadScoreWeights(filepath.Join("..", "score-weights.json"))
+	if err != nil {
+		t.Fatalf("ReadScoreWeights of score-weights.json: %v", err)
+	}
+	if !reflect.DeepEqual(weights, DefaultScoreWeights) {
+		t.Errorf("score-weights.json has weights %+v, built-in weights are %+v", weights, DefaultScoreWeights)
+	}
+
+	dir, err := ioutil.TempDir("", "weights")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range map[string]string{
+		"no version":     `{"factors": {"caps": 10}}`,
+		"unknown factor": `{"version": "1", "factors": {"caps": 10, "token_fund_raised": 20}}`,
+		"negative":       `{"version": "1", "factors": {"caps": -10}}`,
+		"zero weights":   `{"version": "1", "factors": {"caps": 0, "fund_balance": 0}}`,
+		"no factors":     `{"version": "1"}`,
+	} {
+		path := filepath.Join(dir, "weights.json")
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if weights, err := ReadScoreWeights(path); err == nil {
+			t.Errorf("%s: ReadScoreWeights returned %+v, want error", name, weights)
+		}
+	}
+}
+
+// scoredData returns analysis result with every factor of the trust score fully satisfied
+func scoredData() *types.CalculatedData {
+	r := new(types.CalculatedData)
+	r.TokenCheckResult.FundsRaisedResult = types.FundsRaisedResult{FundsRaisedCheck: types.CheckPassed}
+	r.IcoWalletCheckResult = types.FundsRaisedResult{FundsRaisedCheck: types.CheckPassed, FundsRaisedDiff: 0.1}
+	r.Metrics.DistributionStartFromIcoStart = "15 Apr 2018"
+	r.IcoEthIn = types.NewAmount(big.NewInt(100), 0)
+	r.Metrics.FundsBalanceEth = types.NewAmount(big.NewInt(100), 0)
+	r.Metrics.Holders = &types.HolderDistribution{Holders: 1000}
+	r.CapCheckResult.Result = types.CheckPassed
+	r.ContributionWindowCheckResult.Result = types.CheckPassed
+	r.DistributionStartCheckResult.Result = types.CheckPassed
+	return r
+}
+
+func TestTrustScoreSpreadsSkippedWeights(t *testing.T) {
+	r := new(types.CalculatedData)
+	r.TokenCheckResult.FundsRaisedResult = types.FundsRaisedResult{FundsRaisedCheck: types.CheckPassed}
+	r.IcoWalletCheckResult = types.FundsRaisedResult{FundsRaisedCheck: types.CheckSkipped}
+	r.CapCheckResult.Result = types.CheckPassed
+	r.ContributionWindowCheckResult.Result = types.CheckFailed
+	r.DistributionStartCheckResult.Result = types.CheckInconclusive
+
+	// only token check (20), caps (10) and contribution window (10) have data, the window check failed
+	score := (&Analyser{}).trustScore(r, icoStart, icoEnd)
+	if !closeTo(score.Score, 75) {
+		t.Errorf("trustScore returned score %v, want 75", score.Score)
+	}
+	if score.WeightsVersion != DefaultScoreWeights.Version {
+		t.Errorf("trustScore returned weights version %q, want %q", score.WeightsVersion, DefaultScoreWeights.Version)
+	}
+
+	scored := map[string]bool{FactorTokenFundsRaised: true, FactorCaps: true, FactorContributionWindow: true}
+	var contributions float64
+	for _, f := range score.Factors {
+		if f.Skipped == scored[f.Name] {
+			t.Errorf("trustScore returned factor %+v, want skipped %v", f, !scored[f.Name])
+		}
+		if f.Skipped && (f.Contribution != 0 || f.Reason == "") {
+			t.Errorf("trustScore returned skipped factor %+v, want reason without contribution", f)
+		}
+		contributions += f.Contribution
+	}
+	if !closeTo(contributions, score.Score) {
+		t.Errorf("trustScore returned contributions summing to %v, score is %v", contributions, score.Score)
+	}
+}
+
+func TestTrustScoreRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *types.CalculatedData)
+		want   float64
+	}{
+		{"satisfied", func(r *types.CalculatedData) {}, 100},
+		{"nothing known", func(r *types.CalculatedData) { *r = types.CalculatedData{} }, 0},
+		{"all failed", func(r *types.CalculatedData) {
+			r.TokenCheckResult.FundsRaisedResult = types.FundsRaisedResult{FundsRaisedCheck: types.CheckFailed, FundsRaisedDiff: -5}
+			r.IcoWalletCheckResult = types.FundsRaisedResult{FundsRaisedCheck: types.CheckFailed, FundsRaisedDiff: -1}
+			r.Metrics.DistributionStartFromIcoStart = "01 Jan 2018"
+			r.Metrics.FundsBalanceEth = types.NewAmount(big.NewInt(-1), 0)
+			r.Metrics.Holders.TopHoldersShare = 1
+			r.CapCheckResult.Result = types.CheckFailed
+			r.ContributionWindowCheckResult.Result = types.CheckFailed
+			r.DistributionStartCheckResult.Result = types.CheckFailed
+		}, 0},
+		{"above limits", func(r *types.CalculatedData) {
+			r.TokenCheckResult.FundsRaisedDiff = 5
+			r.Metrics.FundsBalanceEth = types.NewAmount(big.NewInt(1000), 0)
+			r.Metrics.Holders.TopHoldersShare = -1
+		}, 100},
+		{"late distribution", func(r *types.CalculatedData) {
+			r.Metrics.DistributionStartFromIcoStart = "01 Jan 2020"
+		}, 90},
+		{"not a number", func(r *types.CalculatedData) {
+			r.TokenCheckResult.FundsRaisedDiff = math.NaN()
+			r.IcoWalletCheckResult.FundsRaisedDiff = math.Inf(-1)
+		}, 100},
+	}
+
+	for _, tt := range tests {
+		r := scoredData()
+		tt.modify(r)
+		score := (&Analyser{}).trustScore(r, icoStart, icoEnd)
+		if score.Score < 0 || score.Score > maxScore || math.IsNaN(score.Score) {
+			t.Errorf("%s: trustScore returned score %v out of range", tt.name, score.Score)
+		}
+		if !closeTo(score.Score, tt.want) {
+			t.Errorf("%s: trustScore returned score %v, want %v", tt.name, score.Score, tt.want)
+		}
+	}
+
+	// distribution a month after ICO end is within the grace period
+	if v := distributionDelayValue(icoEnd.Add(30*24*time.Hour), icoStart, icoEnd); v != 1 {
+		t.Errorf("distributionDelayValue within grace period is %v, want 1", v)
+	}
+}
@@ -0,0 +1,235 @@
+package analyser
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+var (
+	errNoSources    = errors.New("no data sources configured")
+	errNotSupported = errors.New("not supported by data sources")
+)
+
+// ICOInfoSource provides ICO metadata: claimed funds raised, token price and sale dates
+type ICOInfoSource interface {
+	ICOInfo(ctx context.Context, icoName string) (data types.ICORatingData, icoStartDate time.Time, icoEndDate time.Time, err error)
+}
+
+// ChainExplorer provides on-chain data about the token and the ICO fund wallets
+type ChainExplorer interface {
+	// TokenCount returns number of tokens (in base units) distributed by the token issuing address and distribution dates
+	TokenCount(ctx context.Context, tokenAddress string, tokenDecimals int, icoEndDate time.Time) (tokenCount *big.Int, tokenIssuingAddress string, tokenStartDate string, tokenEndDate string, err error)
+	// CrowdSaleBalance returns total wei received by the address and number of incoming transactions
+	CrowdSaleBalance(ctx context.Context, address string) (balance *big.Int, txnCount int64, err error)
+	// EthBalance returns address where crowdsale funds were forwarded and its current balance in wei
+	EthBalance(ctx context.Context, address string) (fundAddress string, ethBalance *big.Int, err error)
+}
+
+// Contribution is ETH received by the crowdsale address
+type Contribution struct {
+	// Time is unix timestamp of the block the contribution is included in
+	Time int64
+	// Value is contributed amount in wei
+	Value *big.Int
+}
+
+// ContributionLister is chain explorer which lists every ETH contribution received by the crowdsale address
+type ContributionLister interface {
+	CrowdSaleContributions(ctx context.Context, address string) (contributions []Contribution, err error)
+}
+
+// RatePoint is ETH/USD rate at the time
+type RatePoint struct {
+	Time int64
+	Rate float64
+}
+
+// RateSeriesOracle is price oracle which provides ETH/USD rates series over the period
+type RateSeriesOracle interface {
+	// EthRateSeries returns rates sorted by time
+	EthRateSeries(ctx context.Context, startDate, endDate int64) (series []RatePoint, err error)
+}
+
+// PriceOracle provides ETH/USD rates
+type PriceOracle interface {
+	// EthRates returns ETH/USD rates at the beginning and at the end of the period
+	EthRates(ctx context.Context, startDate, endDate int64) (startDateRate, endDateRate float64, err error)
+}
+
+// ICOInfoSources is ICO metadata source which queries sources in order and returns the first successful result
+type ICOInfoSources []ICOInfoSource
+
+// ICOInfo implements ICOInfoSource interface
+func (s ICOInfoSources) ICOInfo(ctx context.Context, icoName string) (data types.ICORatingData, icoStartDate time.Time, icoEndDate time.Time, err error) {
+	err = errNoSources
+	for _, source := range s {
+		data, icoStartDate, icoEndDate, err = source.ICOInfo(ctx, icoName)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// ChainExplorers is chain explorer which queries explorers in order and returns the first successful result
+type ChainExplorers []ChainExplorer
+
+// TokenCount implements ChainExplorer interface
+func (s ChainExplorers) TokenCount(ctx context.Context, tokenAddress string, tokenDecimals int, icoEndDate time.Time) (tokenCount *big.Int, tokenIssuingAddress string, tokenStartDate string, tokenEndDate string, err error) {
+	err = errNoSources
+	for _, explorer := range s {
+		tokenCount, tokenIssuingAddress, tokenStartDate, tokenEndDate, err = explorer.TokenCount(ctx, tokenAddress, tokenDecimals, icoEndDate)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// CrowdSaleBalance implements ChainExplorer interface
+func (s ChainExplorers) CrowdSaleBalance(ctx context.Context, address string) (balance *big.Int, txnCount int64, err error) {
+	err = errNoSources
+	for _, explorer := range s {
+		balance, txnCount, err = explorer.CrowdSaleBalance(ctx, address)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// EthBalance implements ChainExplorer interface
+func (s ChainExplorers) EthBalance(ctx context.Context, address string) (fundAddress string, ethBalance *big.Int, err error) {
+	err = errNoSources
+	for _, explorer := range s {
+		fundAddress, ethBalance, err = explorer.EthBalance(ctx, address)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// CrowdSaleContributions implements ContributionLister interface
+func (s ChainExplorers) CrowdSaleContributions(ctx context.Context, address string) (contributions []Contribution, err error) {
+	err = errNotSupported
+	for _, explorer := range s {
+		if lister, ok := explorer.(ContributionLister); ok {
+			contributions, err = lister.CrowdSaleContributions(ctx, address)
+			if err == nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// TokenTransfers implements TokenTransferLister interface
+func (s ChainExplorers) TokenTransfers(ctx context.Context, tokenAddress string) (transfers []TokenTransfer, err error) {
+	err = errNotSupported
+	for _, explorer := range s {
+		if lister, ok := explorer.(TokenTransferLister); ok {
+			transfers, err = lister.TokenTransfers(ctx, tokenAddress)
+			if err == nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Outflows implements OutflowExplorer interface
+func (s ChainExplorers) Outflows(ctx context.Context, addresses []string) (outflows map[string][]Outflow, err error) {
+	err = errNotSupported
+	for _, explorer := range s {
+		if outflowExplorer, ok := explorer.(OutflowExplorer); ok {
+			outflows, err = outflowExplorer.Outflows(ctx, addresses)
+			if err == nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// IsContract implements OutflowExplorer interface
+func (s ChainExplorers) IsContract(ctx context.Context, address string) (isContract bool, err error) {
+	err = errNotSupported
+	for _, explorer := range s {
+		if outflowExplorer, ok := explorer.(OutflowExplorer); ok {
+			isContract, err = outflowExplorer.IsContract(ctx, address)
+			if err == nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// IsFresh implements OutflowExplorer interface
+func (s ChainExplorers) IsFresh(ctx context.Context, address string, blockNumber uint64) (isFresh bool, err error) {
+	err = errNotSupported
+	for _, explorer := range s {
+		if outflowExplorer, ok := explorer.(OutflowExplorer); ok {
+			isFresh, err = outflowExplorer.IsFresh(ctx, address, blockNumber)
+			if err == nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// PriceOracles is price oracle which queries oracles in order and returns the first successful result
+type PriceOracles []PriceOracle
+
+// EthRates implements PriceOracle interface
+func (s PriceOracles) EthRates(ctx context.Context, startDate, endDate int64) (startDateRate, endDateRate float64, err error) {
+	quote, err := s.EthRateQuote(ctx, startDate, endDate)
+	return quote.StartRate, quote.EndRate, err
+}
+
+// EthRateQuote implements QuotingPriceOracle interface
+func (s PriceOracles) EthRateQuote(ctx context.Context, startDate, endDate int64) (quote EthRateQuote, err error) {
+	err = errNoSources
+	for _, oracle := range s {
+		quote, err = quoteEthRates(ctx, oracle, startDate, endDate)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// EthRateSeries implements RateSeriesOracle interface
+func (s PriceOracles) EthRateSeries(ctx context.Context, startDate, endDate int64) (series []RatePoint, err error) {
+	return firstRateSeries(ctx, s, startDate, endDate)
+}
+
+// firstRateSeries returns rates series of the first oracle which provides non-empty one
+func firstRateSeries(ctx context.Context, oracles []PriceOracle, startDate, endDate int64) (series []RatePoint, err error) {
+	err = errNotSupported
+	for _, oracle := range oracles {
+		if seriesOracle, ok := oracle.(RateSeriesOracle); ok {
+			series, err = seriesOracle.EthRateSeries(ctx, startDate, endDate)
+			if err == nil && len(series) > 0 {
+				return
+			}
+		}
+	}
+	return
+}
+
+// sumContributions returns total wei and number of contributions
+func sumContributions(contributions []Contribution) (balance *big.Int, txnCount int64) {
+	balance = new(big.Int)
+	for _, c := range contributions {
+		balance.Add(balance, c.Value)
+	}
+	txnCount = int64(len(contributions))
+	return
+}
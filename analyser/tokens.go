@@ -0,0 +1,54 @@
+package analyser
+
+import (
+	"math/big"
+	"time"
+)
+
+const dateLayout = "02 Jan 2006"
+
+// tokenDistribution accumulates tokens sent by the token issuing address and tracks distribution dates
+type tokenDistribution struct {
+	icoEndDateEpoch int64
+
+	tokenCount     *big.Int
+	tokenStartDate string
+	tokenEndDate   string
+
+	isTokenStartDateSet bool
+	prevTimestamp       int64
+}
+
+func newTokenDistribution(icoEndDate time.Time) *tokenDistribution {
+	return &tokenDistribution{
+		icoEndDateEpoch: icoEndDate.Unix(),
+		tokenCount:      new(big.Int),
+	}
+}
+
+// add accounts a single token transfer in token base units, transfers must be added in chronological order
+func (d *tokenDistribution) add(timestamp int64, value *big.Int) {
+	if !d.isTokenStartDateSet && value.Sign() != 0 { //checks for the first non zero value and sets tokenStartDate
+		d.tokenStartDate = time.Unix(timestamp, 0).Format(dateLayout)
+		d.isTokenStartDateSet = true
+	} else {
+		if timestamp > d.icoEndDateEpoch && d.tokenEndDate == "" {
+			if d.prevTimestamp == 0 {
+				d.prevTimestamp = d.icoEndDateEpoch
+			}
+			d.tokenEndDate = time.Unix(d.prevTimestamp, 0).Format(dateLayout)
+		}
+		d.prevTimestamp = timestamp
+	}
+
+	d.tokenCount.Add(d.tokenCount, value)
+}
+
+// result returns total number of tokens distributed in base units and distribution dates
+func (d *tokenDistribution) result() (tokenCount *big.Int, tokenStartDate string, tokenEndDate string) {
+	tokenEndDate = d.tokenEndDate
+	if tokenEndDate == "" {
+		tokenEndDate = time.Unix(d.icoEndDateEpoch, 0).Format(dateLayout)
+	}
+	return d.tokenCount, d.tokenStartDate, tokenEndDate
+}
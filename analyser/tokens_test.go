@@ -0,0 +1,78 @@
+package analyser
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+func baseUnits(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("invalid integer %s", s)
+	}
+	return v
+}
+
+func TestTokenDistributionBigValues(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2018, 3, d, 12, 0, 0, 0, time.UTC) }
+
+	d := newTokenDistribution(day(15))
+	d.add(day(1).Unix(), new(big.Int))
+	// values are above 2^53, so they are not exact as float64
+	d.add(day(2).Unix(), baseUnits(t, "1152921504606846977"))
+	d.add(day(10).Unix(), baseUnits(t, "123456789012345678901234567"))
+	d.add(day(20).Unix(), big.NewInt(1))
+
+	tokenCount, tokenStartDate, tokenEndDate := d.result()
+	if want := baseUnits(t, "123456790165267183508081545"); tokenCount.Cmp(want) != 0 {
+		t.Errorf("tokenDistribution counted %v tokens, want %v", tokenCount, want)
+	}
+	if got, want := types.NewAmount(tokenCount, 18).String(), "123456790.165267183508081545"; got != want {
+		t.Errorf("tokenDistribution counted %s tokens, want %s", got, want)
+	}
+	if want := day(2).Format(dateLayout); tokenStartDate != want {
+		t.Errorf("tokenDistribution started on %s, want %s", tokenStartDate, want)
+	}
+	if want := day(10).Format(dateLayout); tokenEndDate != want {
+		t.Errorf("tokenDistribution ended on %s, want %s", tokenEndDate, want)
+	}
+}
+
+func TestNewHolderDistributionBigValues(t *testing.T) {
+	const (
+		issuer = "0x00000000000000000000000000000000000000a1"
+		holder = "0x00000000000000000000000000000000000000b2"
+		dust   = "0x00000000000000000000000000000000000000c3"
+	)
+	minted := baseUnits(t, "2000000000000000000000000001")
+	sent := baseUnits(t, "1000000000000000000000000000")
+
+	// 1 base unit is lost when the minted value is rounded to float64, the issuer would hold nothing then
+	holders := newHolderDistribution([]TokenTransfer{
+		{From: zeroAddress, To: issuer, Value: minted},
+		{From: issuer, To: holder, Value: sent},
+		{From: issuer, To: dust, Value: new(big.Int).Sub(sent, big.NewInt(1))},
+		{From: holder, To: zeroAddress, Value: big.NewInt(0)},
+	}, []string{issuer})
+
+	if holders.Holders != 3 || holders.UniqueRecipients != 3 {
+		t.Errorf("newHolderDistribution found %d holders of %d recipients, want 3 of 3", holders.Holders, holders.UniqueRecipients)
+	}
+
+	// balances are 2 base units, 1e27 and 1e27-1 base units of 2e27+1 in total
+	total := types.NewAmount(minted, 18)
+	if got, want := total.String(), "2000000000.000000000000000001"; got != want {
+		t.Errorf("total supply is %s tokens, want %s", got, want)
+	}
+	wantIssuerShare, _ := new(big.Rat).SetFrac(big.NewInt(2), minted).Float64()
+	if holders.IssuerShare != wantIssuerShare || holders.IssuerShare == 0 {
+		t.Errorf("newHolderDistribution returned issuer share %v, want %v", holders.IssuerShare, wantIssuerShare)
+	}
+	if holders.TopHoldersShare != 1 {
+		t.Errorf("newHolderDistribution returned top holders share %v, want 1", holders.TopHoldersShare)
+	}
+}
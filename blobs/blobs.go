@@ -0,0 +1,40 @@
+package blobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// hashPrefix is prefix of content hashes, it names the hash function
+const hashPrefix = "sha256:"
+
+var (
+	// ErrNotFound is returned when blob does not exist in the store
+	ErrNotFound = errors.New("blob not found")
+	// ErrHashMismatch is returned when content of the blob does not match its hash
+	ErrHashMismatch = errors.New("blob content does not match its hash")
+)
+
+// Store stores blobs addressed by their content
+type Store interface {
+	// Put stores the blob and returns key it's fetched by, storing the same content again returns the same key
+	Put(ctx context.Context, data []byte) (key string, err error)
+	// Get returns the blob stored by the key, ErrNotFound is returned if there is no such blob
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Hash returns content hash of the data, e.g. "sha256:9f86d0..."
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// Verify returns ErrHashMismatch if content hash of the data differs from the hash
+func Verify(data []byte, hash string) error {
+	if Hash(data) != hash {
+		return ErrHashMismatch
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package blobs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var fileKeyRegexp = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// FileStore stores every blob as file named by hex SHA-256 of its content in the directory
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore creates blob store in the directory, the directory is created if it does not exist
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// Name returns storage name written to references of the blobs
+func (s *FileStore) Name() string {
+	return "file"
+}
+
+// Put implements Store interface
+func (s *FileStore) Put(ctx context.Context, data []byte) (key string, err error) {
+	key = strings.TrimPrefix(Hash(data), hashPrefix)
+	path := s.path(key)
+	if _, err = os.Stat(path); err == nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+
+	// blob is written to temporary file and renamed, so readers never see partially written blob
+	tmp, err := ioutil.TempFile(filepath.Dir(path), key+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return
+}
+
+// Get implements Store interface, content of the blob is verified against its key
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if !fileKeyRegexp.MatchString(key) {
+		return nil, ErrNotFound
+	}
+
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Verify(data, hashPrefix+key); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// path spreads blobs over subdirectories named by the first two hex digits of the key
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.Dir, key[:2], key)
+}
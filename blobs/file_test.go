@@ -0,0 +1,89 @@
+package blobs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestFileStore creates blob store in temporary directory, the caller removes the directory
+func newTestFileStore(t *testing.T) *FileStore {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFileStore(t)
+	defer os.RemoveAll(store.Dir)
+	data := []byte(`{"metadata":{"icoName":"test"}}`)
+
+	key, err := store.Put(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimPrefix(Hash(data), hashPrefix); key != want {
+		t.Errorf("Put returned key %s, want %s", key, want)
+	}
+	if again, err := store.Put(ctx, data); err != nil || again != key {
+		t.Errorf("Put of the same content returned %s, %v, want %s", again, err, key)
+	}
+
+	got, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Get returned %s, want %s", got, data)
+	}
+	if err := Verify(got, Hash(data)); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestFileStoreVerifiesHash(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFileStore(t)
+	defer os.RemoveAll(store.Dir)
+
+	key, err := store.Put(ctx, []byte("report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(store.path(key), []byte("tampered report"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get(ctx, key); err != ErrHashMismatch {
+		t.Errorf("Get of tampered blob returned %v, want %v", err, ErrHashMismatch)
+	}
+	if err := Verify([]byte("tampered report"), Hash([]byte("report"))); err != ErrHashMismatch {
+		t.Errorf("Verify of tampered blob returned %v, want %v", err, ErrHashMismatch)
+	}
+}
+
+func TestFileStoreNotFound(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFileStore(t)
+	defer os.RemoveAll(store.Dir)
+
+	for _, key := range []string{
+		strings.TrimPrefix(Hash([]byte("missing")), hashPrefix),
+		"../../etc/passwd",
+		strings.ToUpper(strings.TrimPrefix(Hash([]byte("missing")), hashPrefix)),
+	} {
+		if _, err := store.Get(ctx, key); err != ErrNotFound {
+			t.Errorf("Get(%q) returned %v, want %v", key, err, ErrNotFound)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultIPFSURL is HTTP API URL of local IPFS daemon
+const DefaultIPFSURL = "http://127.0.0.1:5001"
+
+// IPFS stores blobs in IPFS through HTTP API of IPFS node, keys are CIDs of the blobs
+type IPFS struct {
+	// Client is HTTP client used for requests, http.DefaultClient is used when nil
+	Client *http.Client
+	// URL is HTTP API URL of the node, without /api/v0 path
+	URL string
+}
+
+// NewIPFS creates blob store backed by IPFS node with HTTP API at the URL, DefaultIPFSURL is used when the URL is empty
+func NewIPFS(apiURL string) *IPFS {
+	if apiURL == "" {
+		apiURL = DefaultIPFSURL
+	}
+	return &IPFS{URL: strings.TrimRight(apiURL, "/")}
+}
+
+// Name returns storage name written to references of the blobs
+func (s *IPFS) Name() string {
+	return "ipfs"
+}
+
+type ipfsAddResponse struct {
+	Name string `json:"Name"`
+	Hash string `json:"Hash"`
+}
+
+type ipfsErrorResponse struct {
+	Message string `json:"Message"`
+}
+
+// Put implements Store interface, the blob is pinned by the node
+func (s *IPFS) Put(ctx context.Context, data []byte) (key string, err error) {
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("file", "blob")
+	if err != nil {
+		return
+	}
+	if _, err = part.Write(data); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+
+	respBody, err := s.call(ctx, "add", url.Values{"pin": {"true"}}, body, w.FormDataContentType())
+	if err != nil {
+		return
+	}
+
+	var added ipfsAddResponse
+	if err = json.Unmarshal(respBody, &added); err != nil {
+		return
+	}
+	if added.Hash == "" {
+		return "", fmt.Errorf("ipfs add returned no hash")
+	}
+	return added.Hash, nil
+}
+
+// Get implements Store interface
+func (s *IPFS) Get(ctx context.Context, key string) ([]byte, error) {
+	if key == "" {
+		return nil, ErrNotFound
+	}
+	return s.call(ctx, "cat", url.Values{"arg": {key}}, nil, "")
+}
+
+// call calls HTTP API command of the node, the API accepts POST requests only
+func (s *IPFS) call(ctx context.Context, command string, args url.Values, body io.Reader, contentType string) (respBody []byte, err error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v0/"+command+"?"+args.Encode(), body)
+	if err != nil {
+		return
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr ipfsErrorResponse
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("ipfs %s failed: %s", command, apiErr.Message)
+		}
+		return nil, fmt.Errorf("ipfs %s failed: %s", command, resp.Status)
+	}
+	return
+}
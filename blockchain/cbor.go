@@ -0,0 +1,291 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// CBOR major types
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborSimple = 7 << 5
+)
+
+// CBOR simple values and floats
+const (
+	cborFalse   = cborSimple | 20
+	cborTrue    = cborSimple | 21
+	cborNull    = cborSimple | 22
+	cborFloat32 = cborSimple | 26
+	cborFloat64 = cborSimple | 27
+)
+
+// maxCBORDepth limits nesting of decoded arrays and maps
+const maxCBORDepth = 32
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// cborEncoder encodes JSON data model (decoded with json.Decoder.UseNumber) into CBOR,
+// map keys found in the dictionary are encoded as their integer IDs
+type cborEncoder struct {
+	buf  []byte
+	keys map[string]uint64
+}
+
+func (e *cborEncoder) encode(v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		e.buf = append(e.buf, cborNull)
+	case bool:
+		if val {
+			e.buf = append(e.buf, cborTrue)
+		} else {
+			e.buf = append(e.buf, cborFalse)
+		}
+	case json.Number:
+		return e.encodeNumber(val)
+	case string:
+		e.head(cborText, uint64(len(val)))
+		e.buf = append(e.buf, val...)
+	case []interface{}:
+		e.head(cborArray, uint64(len(val)))
+		for _, item := range val {
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		// keys are sorted, so the same value is always encoded the same way
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		e.head(cborMap, uint64(len(val)))
+		for _, k := range keys {
+			if id, ok := e.keys[k]; ok {
+				e.head(cborUint, id)
+			} else {
+				e.head(cborText, uint64(len(k)))
+				e.buf = append(e.buf, k...)
+			}
+			if err := e.encode(val[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %T", v)
+	}
+	return nil
+}
+
+// encodeNumber encodes integers as CBOR integers and other numbers as the shortest lossless float
+func (e *cborEncoder) encodeNumber(n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		if i >= 0 {
+			e.head(cborUint, uint64(i))
+		} else {
+			e.head(cborNegInt, uint64(-(i + 1)))
+		}
+		return nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	if f32 := float32(f); float64(f32) == f {
+		e.buf = append(e.buf, cborFloat32)
+		e.buf = append(e.buf, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], math.Float32bits(f32))
+		return nil
+	}
+	e.buf = append(e.buf, cborFloat64)
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], math.Float64bits(f))
+	return nil
+}
+
+// head appends initial byte of major type with the argument in the shortest form
+func (e *cborEncoder) head(major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		e.buf = append(e.buf, major|byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		e.buf = append(e.buf, major|25, 0, 0)
+		binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(arg))
+	case arg <= math.MaxUint32:
+		e.buf = append(e.buf, major|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(arg))
+	default:
+		e.buf = append(e.buf, major|27, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], arg)
+	}
+}
+
+// cborDecoder decodes CBOR written by cborEncoder into JSON data model, integer map keys are looked up in the dictionary
+type cborDecoder struct {
+	data []byte
+	pos  int
+	keys []string
+}
+
+func (d *cborDecoder) decode(depth int) (v interface{}, err error) {
+	if depth > maxCBORDepth {
+		return nil, errors.New("cbor: data is nested too deeply")
+	}
+	if d.pos >= len(d.data) {
+		return nil, errCBORTruncated
+	}
+
+	initial := d.data[d.pos]
+	switch initial {
+	case cborFalse, cborTrue, cborNull:
+		d.pos++
+		if initial == cborNull {
+			return nil, nil
+		}
+		return initial == cborTrue, nil
+	case cborFloat32:
+		b, err := d.next(1 + 4)
+		if err != nil {
+			return nil, err
+		}
+		return floatNumber(float64(math.Float32frombits(binary.BigEndian.Uint32(b[1:])))), nil
+	case cborFloat64:
+		b, err := d.next(1 + 8)
+		if err != nil {
+			return nil, err
+		}
+		return floatNumber(math.Float64frombits(binary.BigEndian.Uint64(b[1:]))), nil
+	}
+
+	major, arg, err := d.head()
+	if err != nil {
+		return
+	}
+	switch major {
+	case cborUint:
+		return json.Number(strconv.FormatUint(arg, 10)), nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer overflows int64")
+		}
+		return json.Number(strconv.FormatInt(-1-int64(arg), 10)), nil
+	case cborText:
+		return d.text(arg)
+	case cborArray:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMap:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBORTruncated
+		}
+		fields := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.key()
+			if err != nil {
+				return nil, err
+			}
+			if fields[key], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported initial byte 0x%02x", initial)
+}
+
+// key decodes map key, it's either ID of dictionary key or text
+func (d *cborDecoder) key() (string, error) {
+	major, arg, err := d.head()
+	if err != nil {
+		return "", err
+	}
+	switch major {
+	case cborUint:
+		if arg >= uint64(len(d.keys)) {
+			return "", fmt.Errorf("cbor: unknown key ID %d", arg)
+		}
+		return d.keys[arg], nil
+	case cborText:
+		return d.text(arg)
+	}
+	return "", fmt.Errorf("cbor: unsupported map key of major type %d", major>>5)
+}
+
+func (d *cborDecoder) text(length uint64) (string, error) {
+	if length > uint64(len(d.data)-d.pos) {
+		return "", errCBORTruncated
+	}
+	b, err := d.next(int(length))
+	return string(b), err
+}
+
+// head decodes major type and argument of the initial byte, indefinite lengths are not supported
+func (d *cborDecoder) head() (major byte, arg uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return
+	}
+	major, info := b[0]&0xe0, b[0]&0x1f
+
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24:
+		if b, err = d.next(1); err == nil {
+			arg = uint64(b[0])
+		}
+	case info == 25:
+		if b, err = d.next(2); err == nil {
+			arg = uint64(binary.BigEndian.Uint16(b))
+		}
+	case info == 26:
+		if b, err = d.next(4); err == nil {
+			arg = uint64(binary.BigEndian.Uint32(b))
+		}
+	case info == 27:
+		if b, err = d.next(8); err == nil {
+			arg = binary.BigEndian.Uint64(b)
+		}
+	default:
+		err = fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+	return
+}
+
+func (d *cborDecoder) next(n int) ([]byte, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errCBORTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func floatNumber(f float64) json.Number {
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
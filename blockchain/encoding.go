@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Format is encoding of the data written to the passport
+type Format string
+
+const (
+	// FormatJSON is JSON without header, the only format written by earlier versions
+	FormatJSON Format = "json"
+	// FormatCBOR is CBOR with JSON field names replaced by IDs of the key dictionary, it's prefixed by format header
+	FormatCBOR Format = "cbor"
+)
+
+// headerCBORv1 is format header of CBOR with cborKeysV1 dictionary, headers never start JSON
+const headerCBORv1 byte = 0x01
+
+// cborKeysV1 are JSON field names encoded as their index by CBOR v1 format, names are only ever appended,
+// so data written before a name is added stays readable; names missing from the list are encoded as text
+var cborKeysV1 = []string{
+	"metadata", "version", "icoName", "decimals", "tokenContractAddress", "crowdsaleAddress", "ownerAddress",
+	"tokenIssuerAddress", "fundAddress", "ethNominated", "token_tx_input_adjustment", "owner_is_ico_wallet",
+	"confidence", "passportAddress", "txHash", "orderId", "accountAddress", "softCap", "softCapCurrency", "hardCap",
+	"hardCapCurrency", "previousTxHash", "ico_info", "cfr_currency", "cfr", "ico_start_date", "ico_end_date",
+	"ico_price_cur", "ico_price", "ico_price_adjusted", "soft_cap", "soft_cap_currency", "hard_cap",
+	"hard_cap_currency", "calculated_data", "tokens_issued", "token_total_supply", "token", "name", "symbol",
+	"efr_token", "eth_rate_start", "eth_rate_end", "eth_rate_source", "eth_rate_spread", "reporting_currency",
+	"cfr_reporting", "ico_price_reporting", "efr_token_adjusted", "token_check_result", "funds_raised_diff",
+	"funds_raised_check", "funds_raised_check_reason", "max_shortfall", "funds_raised_adjusted_diff", "ico_eth_in",
+	"ico_eth_out", "ico_eth_total", "efr_ico_tx", "efr_ico_tx_time_weighted", "efr_owner_tx_currency",
+	"ico_wallet_check_result", "metrics", "distribution_days", "distribution_start_from_ico_start",
+	"distribution_end_from_ico_end", "funds_balance_eth", "holders", "unique_recipients", "top_holders_count",
+	"top_holders_share", "gini", "issuer_share", "outflows", "to_exchanges", "to_contracts", "to_fresh_eoas",
+	"to_other_eoas", "within_30_days", "destinations", "address", "kind", "label", "eth", "first_transfer",
+	"forwarded_eth", "forwarded_to_exchanges", "cap_check_result", "result", "reason", "thresholds", "evidence",
+	"contribution_window_check_result", "distribution_start_check_result", "trust_score", "score", "weights_version",
+	"factors", "weight", "value", "contribution", "skipped", "warnings", "schema_version", "content_hash", "storage",
+	"key", "summary", "ico_name", "token_contract_address", "previous_tx_hash", "token_check", "ico_wallet_check",
+	"cap_check", "contribution_window_check", "distribution_start_check", "tolerance", "window_start", "window_end",
+	"ico_start", "ico_price_adjusted_reporting",
+}
+
+var cborKeyIDsV1 = make(map[string]uint64, len(cborKeysV1))
+
+func init() {
+	for i, key := range cborKeysV1 {
+		cborKeyIDsV1[key] = uint64(i)
+	}
+}
+
+// ParseFormat returns format by its name
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case FormatJSON, FormatCBOR:
+		return Format(name), nil
+	}
+	return "", fmt.Errorf("unsupported passport data format %q", name)
+}
+
+// EncodeFact encodes ICO passport or reference to it in the format, data of any format is decoded by readers of the passport
+func EncodeFact(v interface{}, format Format) ([]byte, error) {
+	factJSON, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatJSON {
+		return factJSON, nil
+	}
+	if format != FormatCBOR {
+		return nil, fmt.Errorf("unsupported passport data format %q", format)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(factJSON))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	e := &cborEncoder{buf: []byte{headerCBORv1}, keys: cborKeyIDsV1}
+	if err := e.encode(doc); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// factJSON detects format of the fact data by its header and returns the data as JSON
+func factJSON(factBytes []byte) ([]byte, error) {
+	trimmed := bytes.TrimLeft(factBytes, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] == '{' {
+		return factBytes, nil
+	}
+
+	switch factBytes[0] {
+	case headerCBORv1:
+		d := &cborDecoder{data: factBytes, pos: 1, keys: cborKeysV1}
+		doc, err := d.decode(0)
+		if err != nil {
+			return nil, err
+		}
+		if d.pos != len(factBytes) {
+			return nil, fmt.Errorf("cbor: %d bytes left after the data", len(factBytes)-d.pos)
+		}
+		return json.Marshal(doc)
+	}
+	return nil, fmt.Errorf("unknown passport data format header 0x%02x", factBytes[0])
+}
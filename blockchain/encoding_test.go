@@ -0,0 +1,156 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/monetha/ico-analyzer/types"
+	"github.com/monetha/reputation-go-sdk/contracts"
+	"github.com/monetha/reputation-go-sdk/eth/backend"
+)
+
+func TestEncodeFactRoundTrip(t *testing.T) {
+	passport := testPassport()
+	want, err := json.Marshal(passport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		format Format
+		header byte
+	}{
+		{FormatJSON, '{'},
+		{FormatCBOR, headerCBORv1},
+	} {
+		factBytes, err := EncodeFact(passport, test.format)
+		if err != nil {
+			t.Fatalf("EncodeFact as %s: %v", test.format, err)
+		}
+		if factBytes[0] != test.header {
+			t.Errorf("%s data starts with 0x%02x, want 0x%02x", test.format, factBytes[0], test.header)
+		}
+
+		got, err := factJSON(factBytes)
+		if err != nil {
+			t.Fatalf("factJSON of %s data: %v", test.format, err)
+		}
+		decoded := new(types.ICOPassport)
+		if err = json.Unmarshal(got, decoded); err != nil {
+			t.Fatalf("factJSON of %s data returned invalid passport: %v", test.format, err)
+		}
+		if got, _ = json.Marshal(decoded); !bytes.Equal(got, want) {
+			t.Errorf("%s data decoded to %s, want %s", test.format, got, want)
+		}
+	}
+
+	if _, err = EncodeFact(passport, Format("xml")); err == nil {
+		t.Error("EncodeFact succeeded with unsupported format")
+	}
+}
+
+func TestFactJSONLegacy(t *testing.T) {
+	// data written before format headers is JSON, possibly with leading whitespace
+	for _, data := range []string{``, `{"metadata":{"icoName":"test"}}`, "\n\t {\"metadata\":{\"icoName\":\"test\"}}"} {
+		got, err := factJSON([]byte(data))
+		if err != nil {
+			t.Errorf("factJSON(%q): %v", data, err)
+			continue
+		}
+		if string(got) != data {
+			t.Errorf("factJSON(%q) returned %q, want the data unchanged", data, got)
+		}
+	}
+}
+
+func TestFactJSONRejectsBrokenData(t *testing.T) {
+	factBytes, err := EncodeFact(testPassport(), FormatCBOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 1; n < len(factBytes); n++ {
+		if _, err := factJSON(factBytes[:n]); err != errCBORTruncated {
+			t.Fatalf("factJSON of CBOR data truncated to %d of %d bytes returned error %v, want %v", n, len(factBytes), err, errCBORTruncated)
+		}
+	}
+
+	if _, err = factJSON(append(factBytes, 0)); err == nil {
+		t.Error("factJSON succeeded with bytes left after CBOR data")
+	}
+	if _, err = factJSON([]byte{0x02, 0xa0}); err == nil {
+		t.Error("factJSON succeeded with unknown format header")
+	}
+}
+
+// deployPassport deploys passport with its logic and logic registry on simulated backend,
+// the backend extended by the SDK looks up transactions required by eth session
+func deployPassport(b *testing.B, key *ecdsa.PrivateKey) (*backend.SimulatedBackendExt, common.Address) {
+	alloc := core.GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(params.Ether)}}
+	sim := backend.NewSimulatedBackendExtended(alloc, 10000000)
+	auth := bind.NewKeyedTransactor(key)
+
+	logic, _, _, err := contracts.DeployPassportLogicContract(auth, sim)
+	if err != nil {
+		b.Fatalf("deploying passport logic: %v", err)
+	}
+	sim.Commit()
+
+	registry, _, _, err := contracts.DeployPassportLogicRegistryContract(auth, sim, "0.1", logic)
+	if err != nil {
+		b.Fatalf("deploying passport logic registry: %v", err)
+	}
+	sim.Commit()
+
+	passport, _, _, err := contracts.DeployPassportContract(auth, sim, registry)
+	if err != nil {
+		b.Fatalf("deploying passport: %v", err)
+	}
+	sim.Commit()
+
+	return sim, passport
+}
+
+// BenchmarkWriteData writes the passport in every format and logs gas used by the passport contract
+func BenchmarkWriteData(b *testing.B) {
+	ctx := context.Background()
+	key, _ := crypto.GenerateKey()
+	sim, passport := deployPassport(b, key)
+
+	for _, format := range []Format{FormatJSON, FormatCBOR} {
+		factBytes, err := EncodeFact(testPassport(), format)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(string(format), func(b *testing.B) {
+			var gasUsed uint64
+			for i := 0; i < b.N; i++ {
+				txHash, err := WriteData(ctx, passport, sim, key, factBytes)
+				if err != nil {
+					b.Fatalf("WriteData: %v", err)
+				}
+				sim.Commit()
+
+				receipt, err := sim.TransactionReceipt(ctx, txHash)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if receipt.Status != 1 {
+					b.Fatalf("write transaction %s failed", txHash.Hex())
+				}
+				gasUsed = receipt.GasUsed
+			}
+			b.Logf("%s: %d bytes, %d gas", format, len(factBytes), gasUsed)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/monetha/ico-analyzer/blobs"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+var (
+	// txDataUpdatedEventID is topic of TxDataUpdated(address indexed factProvider, bytes32 indexed key) passport event
+	txDataUpdatedEventID = crypto.Keccak256Hash([]byte("TxDataUpdated(address,bytes32)"))
+	// setTxDataMethodID is ID of passport method which stores fact data in the transaction input
+	setTxDataMethodID = crypto.Keccak256([]byte("setTxDataBlockNumber(bytes32,bytes)"))[:4]
+)
+
+// HistoryItem is ICO data written to the passport by a single transaction
+type HistoryItem struct {
+	// Version is number of the write, the first write of the fact provider is version 1
+	Version     int                `json:"version"`
+	TxHash      string             `json:"tx_hash"`
+	BlockNumber uint64             `json:"block_number"`
+	Time        time.Time          `json:"time"`
+	Passport    *types.ICOPassport `json:"passport,omitempty"`
+	// Reference is set when ICO passport is kept in blob store
+	Reference *types.PassportReference `json:"reference,omitempty"`
+	// Error is set when the written data can't be decoded or fetched from blob store
+	Error string `json:"error,omitempty"`
+}
+
+// History returns all ICO data written to the passport by the fact provider since the block, oldest first,
+// ICO passports kept in blob store are fetched when the store is given
+func History(ctx context.Context, passport common.Address, factProvider common.Address, ethClient *ethclient.Client, fromBlock uint64, store blobs.Store) (items []HistoryItem, err error) {
+	logs, err := factLogs(ctx, passport, factProvider, ethClient, fromBlock)
+	if err != nil {
+		return
+	}
+
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+
+		var item *HistoryItem
+		if item, err = ReadHistoryItem(ctx, l.TxHash, ethClient, store); err != nil {
+			return nil, err
+		}
+		item.Version = len(items) + 1
+		items = append(items, *item)
+	}
+	if len(items) == 0 {
+		err = ErrNoData
+	}
+	return
+}
+
+// LatestTxHash returns hash of the last transaction which wrote ICO data of the fact provider to the passport since the block,
+// written data is not read
+func LatestTxHash(ctx context.Context, passport common.Address, factProvider common.Address, ethClient *ethclient.Client, fromBlock uint64) (txHash string, err error) {
+	logs, err := factLogs(ctx, passport, factProvider, ethClient, fromBlock)
+	if err != nil {
+		return
+	}
+
+	for i := len(logs) - 1; i >= 0; i-- {
+		if !logs[i].Removed {
+			return logs[i].TxHash.Hex(), nil
+		}
+	}
+	return "", ErrNoData
+}
+
+// factLogs returns TxDataUpdated events of ICO data written to the passport by the fact provider since the block
+func factLogs(ctx context.Context, passport common.Address, factProvider common.Address, ethClient *ethclient.Client, fromBlock uint64) ([]ethtypes.Log, error) {
+	return ethClient.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(fromBlock),
+		Addresses: []common.Address{passport},
+		Topics: [][]common.Hash{
+			{txDataUpdatedEventID},
+			{common.BytesToHash(factProvider.Bytes())},
+			{common.Hash(factKeyBytes)},
+		},
+	})
+}
+
+// ReadHistoryItem reads ICO data written to the passport by the transaction, Version of the item is not set
+func ReadHistoryItem(ctx context.Context, txHash common.Hash, ethClient *ethclient.Client, store blobs.Store) (item *HistoryItem, err error) {
+	tx, _, err := ethClient.TransactionByHash(ctx, txHash)
+	if err != nil {
+		return
+	}
+	receipt, err := ethClient.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return
+	}
+	// receipts of go-ethereum 1.8 don't have the block number, it's taken from the logs
+	if len(receipt.Logs) == 0 {
+		return nil, fmt.Errorf("transaction %s didn't write passport data", txHash.Hex())
+	}
+	blockNumber := receipt.Logs[0].BlockNumber
+	header, err := ethClient.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return
+	}
+
+	item = &HistoryItem{
+		TxHash:      txHash.Hex(),
+		BlockNumber: blockNumber,
+		Time:        time.Unix(header.Time.Int64(), 0).UTC(),
+	}
+
+	factBytes, err := decodeTxData(tx.Data())
+	if err == nil {
+		item.Passport, item.Reference, err = decodeFact(factBytes)
+	}
+	if err == nil && item.Reference != nil && store != nil {
+		item.Passport, err = FetchReport(ctx, store, item.Reference)
+	}
+	if err != nil {
+		item.Error = err.Error()
+	}
+	return item, nil
+}
+
+// decodeTxData returns fact data from input of setTxDataBlockNumber(bytes32 key, bytes data) transaction
+func decodeTxData(input []byte) ([]byte, error) {
+	if len(input) < len(setTxDataMethodID)+3*common.HashLength || !bytes.Equal(input[:len(setTxDataMethodID)], setTxDataMethodID) {
+		return nil, fmt.Errorf("transaction input is not setTxDataBlockNumber call")
+	}
+	args := input[len(setTxDataMethodID):]
+
+	offset := new(big.Int).SetBytes(args[common.HashLength : 2*common.HashLength])
+	if !offset.IsInt64() || offset.Int64()+common.HashLength > int64(len(args)) {
+		return nil, fmt.Errorf("invalid offset of data in transaction input")
+	}
+	start := offset.Int64() + common.HashLength
+	length := new(big.Int).SetBytes(args[offset.Int64():start])
+	if !length.IsInt64() || start+length.Int64() > int64(len(args)) {
+		return nil, fmt.Errorf("invalid length of data in transaction input")
+	}
+	return args[start : start+length.Int64()], nil
+}
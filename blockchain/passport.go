@@ -1,25 +1,92 @@
 package blockchain
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
 
+	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/monetha/ico-analyzer/blobs"
+	"github.com/monetha/ico-analyzer/types"
 	"github.com/monetha/reputation-go-sdk/eth"
+	"github.com/monetha/reputation-go-sdk/eth/backend"
 	"github.com/monetha/reputation-go-sdk/facts"
 )
 
 var factKey = []byte("ICO Data")
 var factKeyBytes [32]byte
 
-// WriteData writes data for the specific key
-func WriteData(ctx context.Context, passport common.Address, ethClient *ethclient.Client, key *ecdsa.PrivateKey, factBytes []byte) (txHash common.Hash, err error) {
-	ethSession := eth.New(ethClient, log.Warn)
+func init() {
+	copy(factKeyBytes[:], factKey)
+}
+
+var (
+	// ErrNoData is returned when passport has no ICO data written by the fact provider
+	ErrNoData = errors.New("no ICO data found in the passport")
+	// ErrDataMismatch is returned when data read from the passport differs from the written one
+	ErrDataMismatch = errors.New("ICO data read from the passport does not match written data")
+)
+
+// WriteData writes data for the specific key, the backend is Ethereum client or simulated backend of tests
+func WriteData(ctx context.Context, passport common.Address, ethBackend backend.Backend, key *ecdsa.PrivateKey, factBytes []byte) (txHash common.Hash, err error) {
+	ethSession := eth.New(ethBackend, log.Warn)
 	writeSession := ethSession.NewSession(key)
 	provider := facts.NewProvider(writeSession)
-	copy(factKeyBytes[:], factKey)
 	txHash, err = provider.WriteTxData(ctx, passport, factKeyBytes, factBytes)
 	return
 }
+
+// ReadData reads data written by the fact provider for the specific key
+func ReadData(ctx context.Context, passport common.Address, factProvider common.Address, ethClient *ethclient.Client) (factBytes []byte, err error) {
+	ethSession := eth.New(ethClient, log.Warn)
+	reader := facts.NewReader(ethSession)
+	factBytes, err = reader.ReadTxData(ctx, passport, factProvider, factKeyBytes)
+	if err == ethereum.NotFound || (err == nil && len(factBytes) == 0) {
+		err = ErrNoData
+	}
+	return
+}
+
+// ReadPassport reads ICO data written by the fact provider and decodes it into ICO passport,
+// ICO passport the data refers to is fetched from the blob store
+func ReadPassport(ctx context.Context, passport common.Address, factProvider common.Address, ethClient *ethclient.Client, store blobs.Store) (icoPassport *types.ICOPassport, err error) {
+	factBytes, err := ReadData(ctx, passport, factProvider, ethClient)
+	if err != nil {
+		return
+	}
+
+	icoPassport, ref, err := decodeFact(factBytes)
+	if err != nil || ref == nil {
+		return
+	}
+	return FetchReport(ctx, store, ref)
+}
+
+// decodePassport decodes ICO data of the passport fact
+func decodePassport(factBytes []byte) (icoPassport *types.ICOPassport, err error) {
+	icoPassport = new(types.ICOPassport)
+	if err = json.Unmarshal(factBytes, icoPassport); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// VerifyData reads ICO data written by the fact provider and checks that it matches the expected data
+func VerifyData(ctx context.Context, passport common.Address, factProvider common.Address, ethClient *ethclient.Client, expected []byte) error {
+	factBytes, err := ReadData(ctx, passport, factProvider, ethClient)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(factBytes, expected) {
+		return ErrDataMismatch
+	}
+
+	_, _, err = decodeFact(factBytes)
+	return err
+}
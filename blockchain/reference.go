@@ -0,0 +1,99 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/monetha/ico-analyzer/blobs"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// ErrNoBlobStore is returned when the passport refers to report in blob store and no blob store is given
+var ErrNoBlobStore = errors.New("ICO data is kept in blob store, but blob store is not configured")
+
+// StoreReport stores ICO passport in the blob store and returns reference to be written to the passport instead,
+// storage names the blob store in the reference
+func StoreReport(ctx context.Context, store blobs.Store, storage string, icoPassport *types.ICOPassport) (ref *types.PassportReference, err error) {
+	report, err := json.Marshal(icoPassport)
+	if err != nil {
+		return
+	}
+
+	key, err := store.Put(ctx, report)
+	if err != nil {
+		return
+	}
+
+	data := icoPassport.CalculatedData
+	ref = &types.PassportReference{
+		SchemaVersion: types.PassportSchemaVersion,
+		ContentHash:   blobs.Hash(report),
+		Storage:       storage,
+		Key:           key,
+		Summary: types.PassportSummary{
+			IcoName:                 icoPassport.Metadata.IcoName,
+			TokenContractAddress:    icoPassport.Metadata.TokenContractAddress,
+			PreviousTxHash:          icoPassport.Metadata.PreviousTxHash,
+			ReportingCurrency:       data.ReportingCurrency,
+			CfrReporting:            data.CfrReporting,
+			EfrToken:                data.EfrToken,
+			EfrIcoTx:                data.EfrIcoTx,
+			TokenCheck:              data.TokenCheckResult.FundsRaisedCheck,
+			IcoWalletCheck:          data.IcoWalletCheckResult.FundsRaisedCheck,
+			CapCheck:                data.CapCheckResult.Result,
+			ContributionWindowCheck: data.ContributionWindowCheckResult.Result,
+			DistributionStartCheck:  data.DistributionStartCheckResult.Result,
+		},
+	}
+	if data.TrustScore != nil {
+		ref.Summary.TrustScore = &data.TrustScore.Score
+	}
+	return
+}
+
+// FetchReport fetches ICO passport the reference points to from the blob store and verifies its content hash,
+// the store must be the storage named by the reference when the store has a name
+func FetchReport(ctx context.Context, store blobs.Store, ref *types.PassportReference) (icoPassport *types.ICOPassport, err error) {
+	if store == nil {
+		return nil, ErrNoBlobStore
+	}
+	if named, ok := store.(interface{ Name() string }); ok && ref.Storage != named.Name() {
+		return nil, fmt.Errorf("ICO data is kept in %q blob store, but %q blob store is configured", ref.Storage, named.Name())
+	}
+
+	report, err := store.Get(ctx, ref.Key)
+	if err != nil {
+		return
+	}
+	if err = blobs.Verify(report, ref.ContentHash); err != nil {
+		return
+	}
+	return decodePassport(report)
+}
+
+// decodeFact decodes ICO passport or reference to ICO passport kept in blob store from the fact data of any format
+func decodeFact(factBytes []byte) (icoPassport *types.ICOPassport, ref *types.PassportReference, err error) {
+	if factBytes, err = factJSON(factBytes); err != nil {
+		return
+	}
+
+	var probe struct {
+		ContentHash string `json:"content_hash"`
+	}
+	if err = json.Unmarshal(factBytes, &probe); err != nil {
+		return
+	}
+
+	if probe.ContentHash == "" {
+		icoPassport, err = decodePassport(factBytes)
+		return
+	}
+
+	ref = new(types.PassportReference)
+	if err = json.Unmarshal(factBytes, ref); err != nil {
+		return nil, nil, err
+	}
+	return
+}
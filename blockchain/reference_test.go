@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/monetha/ico-analyzer/blobs"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+func testPassport() *types.ICOPassport {
+	p := new(types.ICOPassport)
+	p.Metadata.IcoName = "test"
+	p.Metadata.TokenContractAddress = "0x0000000000000000000000000000000000000001"
+	p.CalculatedData.CapCheckResult.Result = types.CheckPassed
+	return p
+}
+
+func TestDecodeFactDetectsReference(t *testing.T) {
+	passport := testPassport()
+	ref := &types.PassportReference{
+		SchemaVersion: types.PassportSchemaVersion,
+		ContentHash:   "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Storage:       "ipfs",
+		Key:           "QmTest",
+	}
+	ref.Summary.IcoName = "test"
+
+	for _, format := range []Format{FormatJSON, FormatCBOR} {
+		factBytes, err := EncodeFact(passport, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotPassport, gotRef, err := decodeFact(factBytes)
+		if err != nil {
+			t.Fatalf("decodeFact of %s passport: %v", format, err)
+		}
+		if gotRef != nil || gotPassport == nil || gotPassport.Metadata.IcoName != "test" {
+			t.Errorf("decodeFact of %s passport returned %+v, %+v, want the passport", format, gotPassport, gotRef)
+		}
+
+		factBytes, err = EncodeFact(ref, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotPassport, gotRef, err = decodeFact(factBytes)
+		if err != nil {
+			t.Fatalf("decodeFact of %s reference: %v", format, err)
+		}
+		if gotPassport != nil || gotRef == nil || *gotRef != *ref {
+			t.Errorf("decodeFact of %s reference returned %+v, %+v, want %+v", format, gotPassport, gotRef, ref)
+		}
+	}
+}
+
+func TestFetchReport(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := blobs.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := StoreReport(ctx, store, store.Name(), testPassport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Storage != "file" || ref.Summary.CapCheck != types.CheckPassed {
+		t.Errorf("StoreReport returned reference %+v", ref)
+	}
+
+	passport, err := FetchReport(ctx, store, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passport.Metadata.IcoName != "test" {
+		t.Errorf("FetchReport returned %+v, want the stored passport", passport)
+	}
+
+	if _, err := FetchReport(ctx, nil, ref); err != ErrNoBlobStore {
+		t.Errorf("FetchReport without store returned %v, want %v", err, ErrNoBlobStore)
+	}
+
+	ipfsRef := *ref
+	ipfsRef.Storage = "ipfs"
+	if _, err := FetchReport(ctx, store, &ipfsRef); err == nil {
+		t.Error("FetchReport of ipfs reference from file store succeeded, want error")
+	}
+
+	tampered := *ref
+	tampered.ContentHash = blobs.Hash([]byte("another report"))
+	if _, err := FetchReport(ctx, store, &tampered); err != blobs.ErrHashMismatch {
+		t.Errorf("FetchReport of reference with another hash returned %v, want %v", err, blobs.ErrHashMismatch)
+	}
+}
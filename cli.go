@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/monetha/ico-analyzer/analyser"
+	"github.com/monetha/ico-analyzer/blockchain"
+	"github.com/monetha/ico-analyzer/config"
+	"github.com/monetha/ico-analyzer/diff"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+const (
+	outputFormatJSON  = "json"
+	outputFormatTable = "table"
+)
+
+// runAnalyseCommand runs ICO analysis offline and prints the resulting passport,
+// neither payment processor nor passport contracts are touched
+func runAnalyseCommand(args []string) error {
+	fs := flag.NewFlagSet("analyse", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s analyse [flags]\n\nRuns ICO analysis without payment processing and passport writes.\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	var (
+		input         = fs.String("input", "", "JSON file shaped like ICO passport, flags override its metadata (use - for stdin)")
+		icoName       = fs.String("ico", "", "ICO name as used by icorating.com")
+		tokenAddress  = fs.String("token", "", "token contract address")
+		decimals      = fs.Int("decimals", 18, "token decimals")
+		crowdsale     = fs.String("crowdsale", "", "crowdsale contract address")
+		owner         = fs.String("owner", "", "owner address")
+		confidence    = fs.Float64("confidence", 0.1, "confidence used by funds raised checks")
+		format        = fs.String("format", outputFormatJSON, "output format: json or table")
+		rpcURL        = fs.String("rpc", os.Getenv("ETHEREUM_JSON_RPC_URL"), "Ethereum node JSON-RPC URL used by jsonrpc explorer and to read token metadata (env ETHEREUM_JSON_RPC_URL)")
+		chainExplorer = fs.String("explorer", config.ChainExplorerEtherScan, "chain explorer: etherscan or jsonrpc")
+		startBlock    = fs.Uint64("start-block", 0, "first block scanned by jsonrpc explorer, required by jsonrpc explorer")
+		traceMode     = fs.String("trace-mode", "", "how jsonrpc explorer finds internal transactions: trace_filter, debug or none")
+		priceSources  = fs.String("prices", config.PriceSourcePoloniex, "comma separated ETH/USD price sources: poloniex, coingecko, csv (median is taken for several sources)")
+		priceCSVFile  = fs.String("prices-csv", "", "CSV file with date,rate rows used by csv price source")
+		coinGeckoURL  = fs.String("coingecko-url", "", "CoinGecko-style market chart range URL format with from and to placeholders")
+		exchangesFile = fs.String("exchanges", "", "CSV file with address,label rows added to built-in exchange addresses used by outflow tracing")
+		scoreWeights  = fs.String("score-weights", os.Getenv("SCORE_WEIGHTS_FILE"), "JSON file with versioned trust score weights, built-in weights are used when empty (env SCORE_WEIGHTS_FILE)")
+		sections      = fs.String("sections", "", "comma separated analysis stages recomputed for -input passport: "+strings.Join(analyser.Stages, ", ")+"; the passport and the changed fields are printed")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *format != outputFormatJSON && *format != outputFormatTable {
+		return fmt.Errorf("unsupported output format %q", *format)
+	}
+
+	stages, err := analyser.ParseStages(*sections)
+	if err != nil {
+		return err
+	}
+	if len(stages) > 0 && *input == "" {
+		return errors.New("passport to re-analyse is required by -sections, use -input flag")
+	}
+
+	data := new(types.ICOPassport)
+	if *input != "" {
+		if err := readJSONFile(*input, data); err != nil {
+			return fmt.Errorf("failed to read input %s: %v", *input, err)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "ico":
+			data.Metadata.IcoName = *icoName
+		case "token":
+			data.Metadata.TokenContractAddress = *tokenAddress
+		case "decimals":
+			data.Metadata.Decimals = *decimals
+		case "crowdsale":
+			data.Metadata.CrowdSaleAddress = *crowdsale
+		case "owner":
+			data.Metadata.OwnerAddress = *owner
+		case "confidence":
+			data.Metadata.Confidence = *confidence
+		}
+	})
+	if *input == "" {
+		data.Metadata.Decimals = *decimals
+		data.Metadata.Confidence = *confidence
+	}
+
+	request := *data
+	if data.Metadata.Version == 0 && len(stages) == 0 && data.Metadata.IcoName == "" {
+		return errors.New("ICO name is required, use -ico flag")
+	}
+	if data.Metadata.TokenContractAddress == "" {
+		return errors.New("token contract address is required, use -token flag")
+	}
+
+	switch *chainExplorer {
+	case config.ChainExplorerEtherScan:
+	case config.ChainExplorerJSONRPC:
+		if *rpcURL == "" {
+			return errors.New("JSON-RPC URL is required by jsonrpc explorer, use -rpc flag")
+		}
+		startBlockSet := false
+		fs.Visit(func(f *flag.Flag) {
+			startBlockSet = startBlockSet || f.Name == "start-block"
+		})
+		if !startBlockSet {
+			return errors.New("first block scanned by jsonrpc explorer is required, use -start-block flag")
+		}
+	default:
+		return fmt.Errorf("unsupported chain explorer %q", *chainExplorer)
+	}
+
+	// token metadata is read from the node with any explorer
+	var rpcClient *rpc.Client
+	if *rpcURL != "" {
+		var err error
+		if rpcClient, err = rpc.Dial(*rpcURL); err != nil {
+			return fmt.Errorf("failed to dial JSON-RPC (%v): %v", *rpcURL, err)
+		}
+		defer rpcClient.Close()
+	}
+
+	prices, err := newPriceOracle(strings.Split(*priceSources, ","), *priceCSVFile, *coinGeckoURL)
+	if err != nil {
+		return err
+	}
+
+	a := newAnalyser(*chainExplorer, rpcClient, *startBlock, *traceMode, prices)
+	if a.Exchanges, err = loadExchanges(*exchangesFile); err != nil {
+		return err
+	}
+	if a.ScoreWeights, err = loadScoreWeights(*scoreWeights); err != nil {
+		return err
+	}
+	analysedData, icoRatingData, err := a.RunStages(context.Background(), data, analyser.Options{Stages: stages})
+	if err != nil {
+		return fmt.Errorf("analysis failed: %v", err)
+	}
+
+	icoPassport := getICOPassport(analysedData, icoRatingData, *data)
+	var result interface{} = icoPassport
+	if len(stages) > 0 {
+		changes, err := diff.JSON(request, icoPassport)
+		if err != nil {
+			return fmt.Errorf("failed to compare re-analysed passport with the input: %v", err)
+		}
+		result = reanalysisResult{Passport: icoPassport, Changes: changes}
+	}
+
+	if *format == outputFormatTable {
+		return printTable(os.Stdout, result)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// reanalysisResult is passport re-analysed by sections with the fields changed from the input passport
+type reanalysisResult struct {
+	Passport types.ICOPassport `json:"passport"`
+	Changes  []diff.Change     `json:"changes"`
+}
+
+// readJSONFile decodes JSON file into v, "-" reads standard input
+func readJSONFile(path string, v interface{}) error {
+	var (
+		b   []byte
+		err error
+	)
+	if path == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// printTable prints every field of the value as a row with JSON path and value
+func printTable(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var fields interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	rows := make(map[string]string)
+	flatten("", fields, rows)
+
+	keys := make([]string, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tVALUE")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%s\n", k, rows[k])
+	}
+	return tw.Flush()
+}
+
+func flatten(prefix string, v interface{}, rows map[string]string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			flatten(strings.TrimPrefix(prefix+"."+k, "."), child, rows)
+		}
+	case []interface{}:
+		for i, child := range val {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), child, rows)
+		}
+	case nil:
+		rows[prefix] = ""
+	default:
+		rows[prefix] = fmt.Sprint(val)
+	}
+}
+
+// runHistoryCommand lists ICO data written to the passport by the fact provider or compares two of its versions
+func runHistoryCommand(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s history [flags]\n\nLists ICO data versions written to the passport, -from or -to compares two versions.\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	var (
+		passport   = fs.String("passport", "", "passport address")
+		provider   = fs.String("provider", "", "fact provider address (default address of MERCHANT_KEY)")
+		rpcURL     = fs.String("rpc", os.Getenv("ETHEREUM_JSON_RPC_URL"), "Ethereum node JSON-RPC URL (env ETHEREUM_JSON_RPC_URL)")
+		startBlock = fs.Uint64("start-block", 0, "first block searched for passport writes (env PASSPORT_START_BLOCK)")
+		from       = fs.Int("from", 0, "version compared with -to (default the version before -to)")
+		to         = fs.Int("to", 0, "version compared with -from (default the latest version)")
+		format     = fs.String("format", outputFormatJSON, "output format: json or table")
+		blobStore  = fs.String("blob-store", os.Getenv("BLOB_STORE"), "blob store ICO passports are fetched from when only references are written: file or ipfs (env BLOB_STORE)")
+		blobDir    = fs.String("blob-store-dir", os.Getenv("BLOB_STORE_DIR"), "directory of file blob store (env BLOB_STORE_DIR)")
+		ipfsURL    = fs.String("ipfs-url", os.Getenv("IPFS_API_URL"), "HTTP API URL of IPFS node used by ipfs blob store (env IPFS_API_URL)")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *format != outputFormatJSON && *format != outputFormatTable {
+		return fmt.Errorf("unsupported output format %q", *format)
+	}
+	reports, err := newBlobStore(*blobStore, *blobDir, *ipfsURL)
+	if err != nil {
+		return err
+	}
+	if !common.IsHexAddress(*passport) {
+		return errors.New("passport address is required, use -passport flag")
+	}
+	if *rpcURL == "" {
+		return errors.New("JSON-RPC URL is required, use -rpc flag")
+	}
+	if *provider == "" {
+		if key := os.Getenv("MERCHANT_KEY"); key != "" {
+			privateKey, err := crypto.HexToECDSA(key)
+			if err != nil {
+				return fmt.Errorf("failed to parse MERCHANT_KEY: %v", err)
+			}
+			*provider = crypto.PubkeyToAddress(privateKey.PublicKey).Hex()
+		}
+	}
+	if !common.IsHexAddress(*provider) {
+		return errors.New("fact provider address is required, use -provider flag")
+	}
+
+	startBlockSet := false
+	fs.Visit(func(f *flag.Flag) {
+		startBlockSet = startBlockSet || f.Name == "start-block"
+	})
+	if value, ok := os.LookupEnv("PASSPORT_START_BLOCK"); ok && !startBlockSet {
+		if *startBlock, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("failed to parse PASSPORT_START_BLOCK: %v", err)
+		}
+	}
+
+	ethClient, err := ethclient.Dial(*rpcURL)
+	if err != nil {
+		return fmt.Errorf("failed to dial JSON-RPC (%v): %v", *rpcURL, err)
+	}
+	defer ethClient.Close()
+
+	items, err := blockchain.History(context.Background(), common.HexToAddress(*passport), common.HexToAddress(*provider), ethClient, *startBlock, reports)
+	if err != nil {
+		return fmt.Errorf("failed to read history of passport %s: %v", *passport, err)
+	}
+
+	compare := false
+	fs.Visit(func(f *flag.Flag) {
+		compare = compare || f.Name == "from" || f.Name == "to"
+	})
+
+	var result interface{} = items
+	if compare {
+		if result, err = historyDiff(items, *from, *to); err != nil {
+			return err
+		}
+	}
+
+	if *format == outputFormatTable {
+		if compare {
+			return printChanges(os.Stdout, result.(historyDiffResponse).Changes)
+		}
+		return printHistory(os.Stdout, items)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// printHistory prints a row for every version of passport ICO data
+func printHistory(w io.Writer, items []blockchain.HistoryItem) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tTX HASH\tBLOCK\tTIME\tERROR")
+	for _, item := range items {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", item.Version, item.TxHash, item.BlockNumber, item.Time.Format(time.RFC3339), item.Error)
+	}
+	return tw.Flush()
+}
+
+// printChanges prints a row with JSON encoded old and new values for every changed field
+func printChanges(w io.Writer, changes []diff.Change) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tOLD\tNEW")
+	for _, c := range changes {
+		oldValue, err := json.Marshal(c.Old)
+		if err != nil {
+			return err
+		}
+		newValue, err := json.Marshal(c.New)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Path, oldValue, newValue)
+	}
+	return tw.Flush()
+}
@@ -3,12 +3,59 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 )
 
 const (
 	ethereumJSONRPCURLEnvName      = "ETHEREUM_JSON_RPC_URL"
 	merchantKeyEnvName             = "MERCHANT_KEY"
 	paymentProcessorAddressEnvName = "PAYMENT_PROCESSOR_ADDRESS"
+	chainExplorerEnvName           = "CHAIN_EXPLORER"
+	explorerStartBlockEnvName      = "EXPLORER_START_BLOCK"
+	explorerTraceModeEnvName       = "EXPLORER_TRACE_MODE"
+	jobStoreDirEnvName             = "JOB_STORE_DIR"
+	jobStoreTableEnvName           = "JOB_STORE_TABLE"
+	priceSourcesEnvName            = "PRICE_SOURCES"
+	priceCSVFileEnvName            = "PRICE_CSV_FILE"
+	coinGeckoURLEnvName            = "COINGECKO_URL"
+	exchangesFileEnvName           = "EXCHANGES_FILE"
+	scoreWeightsFileEnvName        = "SCORE_WEIGHTS_FILE"
+	blobStoreEnvName               = "BLOB_STORE"
+	blobStoreDirEnvName            = "BLOB_STORE_DIR"
+	ipfsURLEnvName                 = "IPFS_API_URL"
+	passportFormatEnvName          = "PASSPORT_FORMAT"
+	passportStartBlockEnvName      = "PASSPORT_START_BLOCK"
+)
+
+const (
+	// ChainExplorerJSONRPC is chain explorer which reads data directly from Ethereum node
+	ChainExplorerJSONRPC = "jsonrpc"
+	// ChainExplorerEtherScan is chain explorer which reads data from etherscan.io API
+	ChainExplorerEtherScan = "etherscan"
+)
+
+const (
+	// PriceSourcePoloniex is ETH/USD price source backed by poloniex.com chart data
+	PriceSourcePoloniex = "poloniex"
+	// PriceSourceCoinGecko is ETH/USD price source backed by CoinGecko market chart history
+	PriceSourceCoinGecko = "coingecko"
+	// PriceSourceCSV is ETH/USD price source backed by static CSV file
+	PriceSourceCSV = "csv"
+)
+
+const (
+	// BlobStoreFile is blob store keeping reports as files in local directory
+	BlobStoreFile = "file"
+	// BlobStoreIPFS is blob store keeping reports in IPFS
+	BlobStoreIPFS = "ipfs"
+)
+
+const (
+	// PassportFormatJSON writes passport data as JSON
+	PassportFormatJSON = "json"
+	// PassportFormatCBOR writes passport data as compact CBOR with format header
+	PassportFormatCBOR = "cbor"
 )
 
 var (
@@ -18,6 +65,37 @@ var (
 	MerchantKey string
 	//PaymentProcessorAddress for calling refundPayment and processPayment method
 	PaymentProcessorAddress string
+	//ChainExplorer selects source of on-chain data for the analyser, "etherscan" or "jsonrpc",
+	//it's "jsonrpc" by default when ExplorerStartBlock is set and "etherscan" otherwise
+	ChainExplorer string
+	//ExplorerStartBlock is the first block scanned by JSON-RPC chain explorer, it's required by "jsonrpc" explorer
+	ExplorerStartBlock uint64
+	//ExplorerTraceMode selects how JSON-RPC chain explorer finds internal transactions
+	ExplorerTraceMode string
+	//JobStoreDir is directory where analysis jobs are stored, jobs are kept in memory when it and JobStoreTable are empty
+	JobStoreDir string
+	//JobStoreTable is DynamoDB table where analysis jobs are stored, it's required by Lambda function
+	JobStoreTable string
+	//PriceSources is list of ETH/USD price sources, median of their rates is used when there are several
+	PriceSources []string
+	//PriceCSVFile is CSV file with ETH/USD rates used by "csv" price source
+	PriceCSVFile string
+	//CoinGeckoURL is format of CoinGecko-style market chart range URL used by "coingecko" price source
+	CoinGeckoURL string
+	//ExchangesFile is CSV file with address,label rows of exchange addresses added to the built-in list used by outflow tracing
+	ExchangesFile string
+	//ScoreWeightsFile is JSON file with versioned weights of trust score factors, built-in weights are used when it's empty
+	ScoreWeightsFile string
+	//BlobStore selects blob store of full reports, "file" or "ipfs", the whole ICO passport is written to the passport when it's empty
+	BlobStore string
+	//BlobStoreDir is directory of "file" blob store
+	BlobStoreDir string
+	//IPFSURL is HTTP API URL of IPFS node used by "ipfs" blob store
+	IPFSURL string
+	//PassportFormat is encoding of data written to the passport, "json" (default) or "cbor"
+	PassportFormat string
+	//PassportStartBlock is the first block searched for ICO data written to passports, e.g. block of passport factory deployment
+	PassportStartBlock uint64
 )
 
 // Parse will parse all the flags into config variables
@@ -35,7 +113,69 @@ func Parse() error {
 	}
 
 	PaymentProcessorAddress, err = getEnvString(paymentProcessorAddressEnvName)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// JSON-RPC explorer is the default one when its start block is configured
+	defaultExplorer := ChainExplorerEtherScan
+	if _, ok := os.LookupEnv(explorerStartBlockEnvName); ok {
+		defaultExplorer = ChainExplorerJSONRPC
+	}
+	ChainExplorer = getEnvStringDefault(chainExplorerEnvName, defaultExplorer)
+	switch ChainExplorer {
+	case ChainExplorerEtherScan:
+		ExplorerStartBlock = 0
+	case ChainExplorerJSONRPC:
+		// blocks are scanned one by one from the start block, scanning from genesis can't finish in time
+		if ExplorerStartBlock, err = getEnvUint64(explorerStartBlockEnvName); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("environment variable %v has unsupported value %v", chainExplorerEnvName, ChainExplorer)
+	}
+
+	ExplorerTraceMode = getEnvStringDefault(explorerTraceModeEnvName, "")
+	JobStoreDir = getEnvStringDefault(jobStoreDirEnvName, "")
+	JobStoreTable = getEnvStringDefault(jobStoreTableEnvName, "")
+
+	PriceSources = strings.Split(getEnvStringDefault(priceSourcesEnvName, PriceSourcePoloniex), ",")
+	for i, source := range PriceSources {
+		PriceSources[i] = strings.TrimSpace(source)
+		switch PriceSources[i] {
+		case PriceSourcePoloniex, PriceSourceCoinGecko:
+		case PriceSourceCSV:
+			if PriceCSVFile, err = getEnvString(priceCSVFileEnvName); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("environment variable %v has unsupported value %v", priceSourcesEnvName, source)
+		}
+	}
+	CoinGeckoURL = getEnvStringDefault(coinGeckoURLEnvName, "")
+	ExchangesFile = getEnvStringDefault(exchangesFileEnvName, "")
+	ScoreWeightsFile = getEnvStringDefault(scoreWeightsFileEnvName, "")
+
+	BlobStore = getEnvStringDefault(blobStoreEnvName, "")
+	switch BlobStore {
+	case "", BlobStoreIPFS:
+	case BlobStoreFile:
+		if BlobStoreDir, err = getEnvString(blobStoreDirEnvName); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("environment variable %v has unsupported value %v", blobStoreEnvName, BlobStore)
+	}
+	IPFSURL = getEnvStringDefault(ipfsURLEnvName, "")
+
+	PassportFormat = getEnvStringDefault(passportFormatEnvName, PassportFormatJSON)
+	if PassportFormat != PassportFormatJSON && PassportFormat != PassportFormatCBOR {
+		return fmt.Errorf("environment variable %v has unsupported value %v", passportFormatEnvName, PassportFormat)
+	}
+	if PassportStartBlock, err = getEnvUint64Default(passportStartBlockEnvName, 0); err != nil {
+		return err
+	}
+	return nil
 }
 
 func getEnvString(envName string) (string, error) {
@@ -45,3 +185,32 @@ func getEnvString(envName string) (string, error) {
 
 	return "", fmt.Errorf("environment variable %v not found", envName)
 }
+
+func getEnvStringDefault(envName string, defaultValue string) string {
+	if value, ok := os.LookupEnv(envName); ok {
+		return value
+	}
+
+	return defaultValue
+}
+
+func getEnvUint64(envName string) (uint64, error) {
+	value, err := getEnvString(envName)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("environment variable %v has invalid value: %v", envName, err)
+	}
+	return v, nil
+}
+
+func getEnvUint64Default(envName string, defaultValue uint64) (uint64, error) {
+	if _, ok := os.LookupEnv(envName); !ok {
+		return defaultValue, nil
+	}
+
+	return getEnvUint64(envName)
+}
@@ -0,0 +1,83 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a field which value differs between two documents, Old or New is nil when the field is missing
+type Change struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// JSON compares JSON encodings of before and after values field by field and returns changes sorted by path,
+// paths are dot separated JSON names with [i] for array elements, e.g. "calculated_data.outflows.destinations[0].value"
+func JSON(before, after interface{}) (changes []Change, err error) {
+	oldFields, err := fields(before)
+	if err != nil {
+		return
+	}
+	newFields, err := fields(after)
+	if err != nil {
+		return
+	}
+
+	for path, oldValue := range oldFields {
+		// missing field and null are the same
+		newValue := newFields[path]
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, Change{Path: path, Old: oldValue, New: newValue})
+		}
+	}
+	for path, newValue := range newFields {
+		if _, ok := oldFields[path]; !ok && newValue != nil {
+			changes = append(changes, Change{Path: path, New: newValue})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return
+}
+
+// fields returns values of JSON encoding of v by path, empty objects and arrays are kept as values
+func fields(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+	flatten("", doc, values)
+	return values, nil
+}
+
+func flatten(prefix string, v interface{}, values map[string]interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			values[prefix] = val
+		}
+		for k, child := range val {
+			flatten(strings.TrimPrefix(prefix+"."+k, "."), child, values)
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			values[prefix] = val
+		}
+		for i, child := range val {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), child, values)
+		}
+	default:
+		values[prefix] = val
+	}
+}
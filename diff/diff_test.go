@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+type outflow struct {
+	Address string  `json:"address"`
+	Value   float64 `json:"value"`
+}
+
+type document struct {
+	Name     string            `json:"name"`
+	Score    float64           `json:"score"`
+	Note     *string           `json:"note"`
+	Warnings []string          `json:"warnings,omitempty"`
+	Outflows []outflow         `json:"outflows"`
+	Labels   map[string]string `json:"labels"`
+}
+
+func TestJSON(t *testing.T) {
+	note := "updated"
+	before := document{
+		Name:     "ico",
+		Score:    50,
+		Outflows: []outflow{{Address: "0xa", Value: 1}, {Address: "0xb", Value: 2}},
+		Labels:   map[string]string{},
+	}
+	after := document{
+		Name:     "ico",
+		Score:    62.5,
+		Note:     &note,
+		Warnings: []string{"rates are missing"},
+		Outflows: []outflow{{Address: "0xa", Value: 3}},
+		Labels:   map[string]string{"0xa": "exchange"},
+	}
+
+	changes, err := JSON(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Change{
+		{Path: "labels", Old: map[string]interface{}{}},
+		{Path: "labels.0xa", New: "exchange"},
+		{Path: "note", New: "updated"},
+		{Path: "outflows[0].value", Old: 1.0, New: 3.0},
+		{Path: "outflows[1].address", Old: "0xb"},
+		{Path: "outflows[1].value", Old: 2.0},
+		{Path: "score", Old: 50.0, New: 62.5},
+		{Path: "warnings[0]", New: "rates are missing"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("JSON returned\n%#v\nwant\n%#v", changes, want)
+	}
+}
+
+func TestJSONEqual(t *testing.T) {
+	doc := document{Name: "ico", Outflows: []outflow{{Address: "0xa"}}}
+	changes, err := JSON(doc, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("JSON of equal documents returned %v, want no changes", changes)
+	}
+
+	// missing field and null are the same
+	changes, err = JSON(map[string]interface{}{"name": "ico", "note": nil}, map[string]interface{}{"name": "ico"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("JSON of null and missing field returned %v, want no changes", changes)
+	}
+}
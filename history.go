@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/monetha/ico-analyzer/blockchain"
+	"github.com/monetha/ico-analyzer/config"
+	"github.com/monetha/ico-analyzer/diff"
+)
+
+const (
+	historyResource = "history"
+	diffResource    = "diff"
+)
+
+// errVersionNotFound is returned when passport history has no such version
+var errVersionNotFound = errors.New("passport has no ICO data of the version")
+
+// historyDiffResponse lists fields changed between two versions of ICO data in the passport
+type historyDiffResponse struct {
+	From       int           `json:"from"`
+	To         int           `json:"to"`
+	FromTxHash string        `json:"from_tx_hash"`
+	ToTxHash   string        `json:"to_tx_hash"`
+	Changes    []diff.Change `json:"changes"`
+}
+
+// historyDiff compares ICO data of two versions of the history, the latest version is used when to is zero
+// and the version before to when from is zero
+func historyDiff(items []blockchain.HistoryItem, from, to int) (resp historyDiffResponse, err error) {
+	if to == 0 {
+		to = len(items)
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 || from > len(items) || to < 1 || to > len(items) {
+		err = errVersionNotFound
+		return
+	}
+
+	fromItem, toItem := items[from-1], items[to-1]
+	for _, item := range []blockchain.HistoryItem{fromItem, toItem} {
+		if item.Passport == nil {
+			reason := item.Error
+			if reason == "" {
+				reason = blockchain.ErrNoBlobStore.Error()
+			}
+			err = fmt.Errorf("ICO data of version %d is not available: %s", item.Version, reason)
+			return
+		}
+	}
+
+	resp = historyDiffResponse{From: from, To: to, FromTxHash: fromItem.TxHash, ToTxHash: toItem.TxHash}
+	resp.Changes, err = diff.JSON(fromItem.Passport, toItem.Passport)
+	return
+}
+
+// passportResource returns passport address and resource of /passports/{address}/{resource} path
+func passportResource(req events.APIGatewayProxyRequest) (address, resource string) {
+	parts := strings.SplitN(strings.TrimPrefix(req.Path, passportsPath), "/", 2)
+	address = req.PathParameters["address"]
+	if address == "" {
+		address = parts[0]
+	}
+	if len(parts) > 1 {
+		resource = parts[1]
+	}
+	return
+}
+
+func getPassportHistory(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	items, status := readPassportHistory(req)
+	if status != http.StatusOK {
+		return clientError(status)
+	}
+
+	return jsonResponse(http.StatusOK, items, nil)
+}
+
+func getPassportDiff(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var versions [2]int
+	for i, name := range []string{"from", "to"} {
+		if s := req.QueryStringParameters[name]; s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil {
+				return clientError(http.StatusBadRequest)
+			}
+			versions[i] = v
+		}
+	}
+
+	items, status := readPassportHistory(req)
+	if status != http.StatusOK {
+		return clientError(status)
+	}
+
+	resp, err := historyDiff(items, versions[0], versions[1])
+	if err == errVersionNotFound {
+		return clientError(http.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("error: failed to compare ICO data versions: %v", err)
+		return clientError(http.StatusUnprocessableEntity)
+	}
+
+	return jsonResponse(http.StatusOK, resp, nil)
+}
+
+// readPassportHistory reads ICO data history of the passport written by the merchant, HTTP status is returned on failure
+func readPassportHistory(req events.APIGatewayProxyRequest) ([]blockchain.HistoryItem, int) {
+	err := config.Parse()
+	if err != nil {
+		log.Printf("error: failed to parse config: %v", err)
+		return nil, http.StatusInternalServerError
+	}
+
+	address, _ := passportResource(req)
+	if !common.IsHexAddress(address) {
+		return nil, http.StatusBadRequest
+	}
+
+	privateKey, err := crypto.HexToECDSA(config.MerchantKey)
+	if err != nil {
+		log.Printf("error: failed to parse ECDSA private key from the given key: %v", err)
+		return nil, http.StatusInternalServerError
+	}
+
+	ethClient, err := ethclient.Dial(config.EthereumJSONRPCURL)
+	if err != nil {
+		log.Printf("error: failed to dial JSON-RPC (%v): %v", config.EthereumJSONRPCURL, err)
+		return nil, http.StatusInternalServerError
+	}
+	defer ethClient.Close()
+
+	blobStore, err := newBlobStore(config.BlobStore, config.BlobStoreDir, config.IPFSURL)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return nil, http.StatusInternalServerError
+	}
+
+	factProvider := crypto.PubkeyToAddress(privateKey.PublicKey)
+	items, err := blockchain.History(context.Background(), common.HexToAddress(address), factProvider, ethClient, config.PassportStartBlock, blobStore)
+	if err == blockchain.ErrNoData {
+		return nil, http.StatusNotFound
+	}
+	if err != nil {
+		log.Printf("error: reading history of passport %s failed: %v", address, err)
+		return nil, http.StatusInternalServerError
+	}
+	return items, http.StatusOK
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	lambdaservice "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/monetha/ico-analyzer/config"
+	"github.com/monetha/ico-analyzer/jobs"
+)
+
+// orderLockTTL is how long the order stays locked by its job, it's longer than Lambda timeout;
+// the running job extends the lock every time it records progress
+const orderLockTTL = 20 * time.Minute
+
+// jobEvent is payload of asynchronous invocation of Lambda function which runs the job,
+// LockOwner is owner of the order lock taken by the request which created the job
+type jobEvent struct {
+	JobID     string `json:"job_id"`
+	LockOwner string `json:"lock_owner"`
+}
+
+// getJobStore returns job store selected by config, config must be parsed before the first call;
+// Lambda function requires DynamoDB store, jobs in memory or files are not shared by its containers
+func getJobStore() (jobs.Store, error) {
+	jobStoreOnce.Do(func() {
+		switch {
+		case config.JobStoreTable != "":
+			sess, err := session.NewSession(aws.NewConfig())
+			if err != nil {
+				jobStoreErr = err
+				return
+			}
+			jobStore = jobs.NewDynamoDBStore(dynamodb.New(sess), config.JobStoreTable)
+		case lambdaMode:
+			jobStoreErr = errors.New("JOB_STORE_TABLE is required by Lambda function, jobs in memory or files are not shared by its containers")
+		case config.JobStoreDir != "":
+			jobStore, jobStoreErr = jobs.NewFileStore(config.JobStoreDir)
+		default:
+			jobStore = jobs.NewMemoryStore()
+		}
+	})
+	return jobStore, jobStoreErr
+}
+
+// handleLambda handles API Gateway requests and job events the function sends to itself
+func handleLambda(payload json.RawMessage) (interface{}, error) {
+	var event jobEvent
+	if err := json.Unmarshal(payload, &event); err == nil && event.JobID != "" {
+		runStoredJob(event.JobID, event.LockOwner)
+		return nil, nil
+	}
+
+	var req events.APIGatewayProxyRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	return router(req)
+}
+
+// startJob runs the job in the background: HTTP server runs it in a goroutine, Lambda function invokes itself
+// asynchronously with the job ID, because Lambda execution environment is frozen once the response is returned
+func startJob(store jobs.Store, job *jobs.Job, lockOwner string, privateKey *ecdsa.PrivateKey) error {
+	if lambdaMode {
+		return invokeJob(job.ID, lockOwner)
+	}
+
+	runningJobs.Add(1)
+	go runJob(store, job, lockOwner, privateKey)
+	return nil
+}
+
+// unlockOrder releases the order lock, the lock expires anyway if it can't be released
+func unlockOrder(store jobs.Store, orderID int64, lockOwner string) {
+	if err := store.Unlock(orderID, lockOwner); err != nil {
+		log.Printf("error: failed to unlock order %d: %v", orderID, err)
+	}
+}
+
+// invokeJob sends job event to the running Lambda function, the invocation returns without waiting for the job
+func invokeJob(id, lockOwner string) error {
+	payload, err := json.Marshal(jobEvent{JobID: id, LockOwner: lockOwner})
+	if err != nil {
+		return err
+	}
+
+	sess, err := session.NewSession(aws.NewConfig())
+	if err != nil {
+		return err
+	}
+
+	_, err = lambdaservice.New(sess).Invoke(&lambdaservice.InvokeInput{
+		FunctionName:   aws.String(os.Getenv("AWS_LAMBDA_FUNCTION_NAME")),
+		InvocationType: aws.String(lambdaservice.InvocationTypeEvent),
+		Payload:        payload,
+	})
+	return err
+}
+
+// runStoredJob runs the job read from the store, errors are recorded in the job, so the invocation is not retried
+func runStoredJob(id, lockOwner string) {
+	if err := config.Parse(); err != nil {
+		log.Printf("error: failed to parse config: %v", err)
+		return
+	}
+
+	store, err := getJobStore()
+	if err != nil {
+		log.Printf("error: failed to open job store: %v", err)
+		return
+	}
+
+	job, err := store.Get(id)
+	if err != nil {
+		log.Printf("error: failed to get job %s: %v", id, err)
+		return
+	}
+
+	privateKey, err := crypto.HexToECDSA(config.MerchantKey)
+	if err != nil {
+		log.Printf("error: failed to parse ECDSA private key from the given key: %v", err)
+		unlockOrder(store, job.OrderID, lockOwner)
+		return
+	}
+
+	runningJobs.Add(1)
+	runJob(store, job, lockOwner, privateKey)
+}
+
+// runJob runs the order processing pipeline and records progress of the job in the store,
+// stages completed by a previous run of the same job are skipped; the order lock is released when it's finished
+func runJob(store jobs.Store, job *jobs.Job, lockOwner string, privateKey *ecdsa.PrivateKey) {
+	defer runningJobs.Done()
+	defer unlockOrder(store, job.OrderID, lockOwner)
+
+	fail := func(err error) {
+		job.Error = err.Error()
+		if job.Stage != jobs.StageRefunded {
+			job.SetStage(jobs.StageFailed)
+		}
+		if err := store.Update(job); err != nil {
+			log.Printf("error: failed to update job %s: %v", job.ID, err)
+		}
+	}
+
+	rpcClient, err := rpc.Dial(config.EthereumJSONRPCURL)
+	if err != nil {
+		log.Printf("error: failed to dial JSON-RPC (%v): %v", config.EthereumJSONRPCURL, err)
+		fail(err)
+		return
+	}
+	defer rpcClient.Close()
+	ethClient := ethclient.NewClient(rpcClient)
+
+	prices, err := newPriceOracle(config.PriceSources, config.PriceCSVFile, config.CoinGeckoURL)
+	if err != nil {
+		log.Printf("error: failed to create price oracle: %v", err)
+		fail(err)
+		return
+	}
+
+	a := newAnalyser(config.ChainExplorer, rpcClient, config.ExplorerStartBlock, config.ExplorerTraceMode, prices)
+	if a.Exchanges, err = loadExchanges(config.ExchangesFile); err != nil {
+		log.Printf("error: %v", err)
+		fail(err)
+		return
+	}
+	if a.ScoreWeights, err = loadScoreWeights(config.ScoreWeightsFile); err != nil {
+		log.Printf("error: %v", err)
+		fail(err)
+		return
+	}
+	reports, err := newBlobStore(config.BlobStore, config.BlobStoreDir, config.IPFSURL)
+	if err != nil {
+		log.Printf("error: %v", err)
+		fail(err)
+		return
+	}
+	p, err := newOrderProcessor(ethClient, privateKey, a, store, job, lockOwner, reports)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	if err = p.process(context.Background()); err != nil {
+		fail(err)
+		return
+	}
+
+	log.Printf("ICO analysis successfully done for token address : %s for which payment is done by txn : %s", job.Request.Metadata.TokenContractAddress, job.Request.Metadata.TxHash)
+}
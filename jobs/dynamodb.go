@@ -0,0 +1,202 @@
+package jobs
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const (
+	dynamoDBKey     = "id"
+	dynamoDBJob     = "job"
+	dynamoDBJobID   = "job_id"
+	dynamoDBOwner   = "owner"
+	dynamoDBUntil   = "until"
+	orderItemPrefix = "order-"
+	lockItemPrefix  = "lock-"
+	keyNotExists    = "attribute_not_exists(#id)"
+	keyExists       = "attribute_exists(#id)"
+)
+
+// keyName is placeholder of the key attribute in condition expressions
+var keyName = map[string]*string{"#id": aws.String(dynamoDBKey)}
+
+// DynamoDBStore stores every job as JSON in an item of DynamoDB table with string partition key "id",
+// ID of the latest job of every order is stored in "order-{orderId}" item and order lock in "lock-{orderId}" item;
+// the store is shared by all processes using the table, e.g. all containers of Lambda function
+type DynamoDBStore struct {
+	Client dynamodbiface.DynamoDBAPI
+	Table  string
+}
+
+// NewDynamoDBStore creates job store in the DynamoDB table
+func NewDynamoDBStore(client dynamodbiface.DynamoDBAPI, table string) *DynamoDBStore {
+	return &DynamoDBStore{Client: client, Table: table}
+}
+
+// Create implements Store interface
+func (s *DynamoDBStore) Create(job *Job) error {
+	if !ValidID(job.ID) {
+		return ErrInvalidID
+	}
+
+	if err := s.put(job, keyNotExists); err != nil {
+		if isConditionFailure(err) {
+			return ErrExists
+		}
+		return err
+	}
+
+	_, err := s.Client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item: map[string]*dynamodb.AttributeValue{
+			dynamoDBKey:   {S: aws.String(orderItemKey(job.OrderID))},
+			dynamoDBJobID: {S: aws.String(job.ID)},
+		},
+	})
+	return err
+}
+
+// Get implements Store interface
+func (s *DynamoDBStore) Get(id string) (*Job, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+
+	item, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := item[dynamoDBJob]
+	if !ok || data.S == nil {
+		return nil, ErrNotFound
+	}
+
+	job := new(Job)
+	err = json.Unmarshal([]byte(*data.S), job)
+	return job, err
+}
+
+// Update implements Store interface
+func (s *DynamoDBStore) Update(job *Job) error {
+	if !ValidID(job.ID) {
+		return ErrInvalidID
+	}
+
+	err := s.put(job, keyExists)
+	if isConditionFailure(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// FindByOrderID implements Store interface
+func (s *DynamoDBStore) FindByOrderID(orderID int64) (*Job, error) {
+	item, err := s.get(orderItemKey(orderID))
+	if err != nil {
+		return nil, err
+	}
+	id, ok := item[dynamoDBJobID]
+	if !ok || id.S == nil {
+		return nil, ErrNotFound
+	}
+
+	return s.Get(*id.S)
+}
+
+// Lock implements Store interface
+func (s *DynamoDBStore) Lock(orderID int64, owner string, until time.Time) error {
+	_, err := s.Client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item: map[string]*dynamodb.AttributeValue{
+			dynamoDBKey:   {S: aws.String(lockItemKey(orderID))},
+			dynamoDBOwner: {S: aws.String(owner)},
+			dynamoDBUntil: {N: aws.String(strconv.FormatInt(until.Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(#id) OR #owner = :owner OR #until < :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id":    aws.String(dynamoDBKey),
+			"#owner": aws.String(dynamoDBOwner),
+			"#until": aws.String(dynamoDBUntil),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(owner)},
+			":now":   {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+	})
+	if isConditionFailure(err) {
+		return ErrLocked
+	}
+	return err
+}
+
+// Unlock implements Store interface
+func (s *DynamoDBStore) Unlock(orderID int64, owner string) error {
+	_, err := s.Client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                aws.String(s.Table),
+		Key:                      map[string]*dynamodb.AttributeValue{dynamoDBKey: {S: aws.String(lockItemKey(orderID))}},
+		ConditionExpression:      aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{"#owner": aws.String(dynamoDBOwner)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(owner)},
+		},
+	})
+	if isConditionFailure(err) {
+		// the lock is released or taken over by another owner after it expired
+		return nil
+	}
+	return err
+}
+
+// put writes the job item if the condition holds
+func (s *DynamoDBStore) put(job *Job, condition string) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item: map[string]*dynamodb.AttributeValue{
+			dynamoDBKey: {S: aws.String(job.ID)},
+			dynamoDBJob: {S: aws.String(string(b))},
+		},
+		ConditionExpression:      aws.String(condition),
+		ExpressionAttributeNames: keyName,
+	})
+	return err
+}
+
+// get reads the item with consistent read, so writes of other processes are seen right away
+func (s *DynamoDBStore) get(key string) (map[string]*dynamodb.AttributeValue, error) {
+	out, err := s.Client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.Table),
+		Key:            map[string]*dynamodb.AttributeValue{dynamoDBKey: {S: aws.String(key)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Item) == 0 {
+		return nil, ErrNotFound
+	}
+	return out.Item, nil
+}
+
+func orderItemKey(orderID int64) string {
+	return orderItemPrefix + strconv.FormatInt(orderID, 10)
+}
+
+func lockItemKey(orderID int64) string {
+	return lockItemPrefix + strconv.FormatInt(orderID, 10)
+}
+
+func isConditionFailure(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
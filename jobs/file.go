@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ordersDir = "orders"
+	locksDir  = "locks"
+)
+
+// FileStore stores every job as JSON file in the directory,
+// ID of the latest job of every order is stored in "orders" subdirectory and order locks in "locks" subdirectory;
+// a free lock is taken by exclusive creation of its file, so processes sharing the directory don't take it both
+type FileStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewFileStore creates job store in the directory, the directory is created if it does not exist
+func NewFileStore(dir string) (*FileStore, error) {
+	for _, sub := range []string{ordersDir, locksDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// Create implements Store interface
+func (s *FileStore) Create(job *Job) error {
+	if !ValidID(job.ID) {
+		return ErrInvalidID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path(job.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return ErrExists
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := s.write(job); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.orderPath(job.OrderID), []byte(job.ID), 0600)
+}
+
+// Get implements Store interface
+func (s *FileStore) Get(id string) (*Job, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+
+	b, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job := new(Job)
+	err = json.Unmarshal(b, job)
+	return job, err
+}
+
+// Update implements Store interface
+func (s *FileStore) Update(job *Job) error {
+	if !ValidID(job.ID) {
+		return ErrInvalidID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(s.path(job.ID)); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	return s.write(job)
+}
+
+// write atomically replaces job file, so readers never see partially written job
+func (s *FileStore) write(job *Job) error {
+	return s.replace(s.path(job.ID), job)
+}
+
+// replace atomically replaces the file with JSON of v
+func (s *FileStore) replace(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(s.Dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// FindByOrderID implements Store interface
+func (s *FileStore) FindByOrderID(orderID int64) (*Job, error) {
+	id, err := ioutil.ReadFile(s.orderPath(orderID))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(strings.TrimSpace(string(id)))
+}
+
+// Lock implements Store interface
+func (s *FileStore) Lock(orderID int64, owner string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.lockPath(orderID)
+	lock := orderLock{Owner: owner, Until: until}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		err = json.NewEncoder(f).Encode(lock)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	if !os.IsExist(err) {
+		return err
+	}
+
+	// the order is locked already, the lock is replaced when it's held by the owner or expired
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var current orderLock
+	if err := json.Unmarshal(b, &current); err == nil && current.excludes(owner, time.Now()) {
+		return ErrLocked
+	}
+
+	return s.replace(path, lock)
+}
+
+// Unlock implements Store interface
+func (s *FileStore) Unlock(orderID int64, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.lockPath(orderID)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var current orderLock
+	if err := json.Unmarshal(b, &current); err == nil && current.Owner != owner {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+func (s *FileStore) orderPath(orderID int64) string {
+	return filepath.Join(s.Dir, ordersDir, strconv.FormatInt(orderID, 10))
+}
+
+func (s *FileStore) lockPath(orderID int64) string {
+	return filepath.Join(s.Dir, locksDir, strconv.FormatInt(orderID, 10))
+}
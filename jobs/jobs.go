@@ -0,0 +1,188 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/monetha/ico-analyzer/diff"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// Stage is a processing stage of analysis job
+type Stage string
+
+const (
+	// StageQueued is stage of a job which is accepted but not started yet
+	StageQueued Stage = "queued"
+	// StagePaymentVerified is stage of a job which order payment is verified
+	StagePaymentVerified Stage = "payment_verified"
+	// StageAnalysing is stage of a job which ICO analysis is in progress
+	StageAnalysing Stage = "analysing"
+	// StageWritingPassport is stage of a job which analysis result is being written to the passport
+	StageWritingPassport Stage = "writing_passport"
+	// StageProcessingPayment is stage of a job which order payment is being processed
+	StageProcessingPayment Stage = "processing_payment"
+	// StageCompleted is final stage of a successful job
+	StageCompleted Stage = "completed"
+	// StageRefunded is final stage of a job which analysis failed and order payment was refunded
+	StageRefunded Stage = "refunded"
+	// StageFailed is final stage of a job which failed
+	StageFailed Stage = "failed"
+)
+
+var (
+	// ErrNotFound is returned when job does not exist in the store
+	ErrNotFound = errors.New("job not found")
+	// ErrExists is returned when job with the same ID already exists in the store
+	ErrExists = errors.New("job already exists")
+	// ErrInvalidID is returned when job ID has invalid format
+	ErrInvalidID = errors.New("invalid job ID")
+	// ErrLocked is returned when the order is locked by another owner
+	ErrLocked = errors.New("order is locked")
+
+	idRegexp = regexp.MustCompile("^[0-9a-f]{32}$")
+)
+
+// StageTime is time when job entered the stage
+type StageTime struct {
+	Stage Stage     `json:"stage"`
+	Time  time.Time `json:"time"`
+}
+
+// Job is ICO analysis job, it records progress of the order through processing stages,
+// so processing can be resumed from the last completed stage
+type Job struct {
+	ID        string      `json:"id"`
+	OrderID   int64       `json:"order_id"`
+	TxHash    string      `json:"tx_hash"`
+	Stage     Stage       `json:"stage"`
+	Stages    []StageTime `json:"stages"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	// Request is analysis request of the order
+	Request *types.ICOPassport `json:"request,omitempty"`
+	// Sections are analysis stages recomputed for the passport of the request, all stages are run when empty
+	Sections []string `json:"sections,omitempty"`
+	// Passport is analysis result, it's set as soon as analysis is completed
+	Passport *types.ICOPassport `json:"passport,omitempty"`
+	// Changes are fields of the request passport changed by re-analysis of Sections
+	Changes []diff.Change `json:"changes,omitempty"`
+	// WriteTxHash is hash of transaction writing the analysis result to the passport
+	WriteTxHash string `json:"write_tx_hash,omitempty"`
+	// PaymentTxHash is hash of transaction processing the order payment
+	PaymentTxHash string `json:"payment_tx_hash,omitempty"`
+	// RefundTxHash is hash of transaction refunding the order payment
+	RefundTxHash string `json:"refund_tx_hash,omitempty"`
+	// WithdrawTxHash is hash of transaction withdrawing the refund to the client
+	WithdrawTxHash string `json:"withdraw_tx_hash,omitempty"`
+	// RefundReason is the reason code the order payment is refunded with
+	RefundReason string `json:"refund_reason,omitempty"`
+	// PaymentToken is address of ERC20 token the order is paid with, it's empty for orders paid with ETH
+	PaymentToken string `json:"payment_token,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Store stores analysis jobs
+type Store interface {
+	// Create stores new job, ErrExists is returned if job with the same ID is already stored
+	Create(job *Job) error
+	// Get returns stored job, ErrNotFound is returned if job does not exist
+	Get(id string) (*Job, error)
+	// Update replaces stored job, ErrNotFound is returned if job does not exist
+	Update(job *Job) error
+	// FindByOrderID returns the latest job created for the order, ErrNotFound is returned if there is no such job
+	FindByOrderID(orderID int64) (*Job, error)
+	// Lock locks the order for the owner until the given time, so only one job of the order runs at once;
+	// the owner extends its own lock, ErrLocked is returned if another owner holds the lock which hasn't expired
+	Lock(orderID int64, owner string, until time.Time) error
+	// Unlock releases the lock of the order if it's held by the owner
+	Unlock(orderID int64, owner string) error
+}
+
+// orderLock is lock of the order held by the owner until the time
+type orderLock struct {
+	Owner string    `json:"owner"`
+	Until time.Time `json:"until"`
+}
+
+// excludes returns true if the lock prevents the owner from locking the order at the time
+func (l orderLock) excludes(owner string, now time.Time) bool {
+	return l.Owner != owner && now.Before(l.Until)
+}
+
+// New creates job in queued stage with random ID
+func New(request types.ICOPassport) (*Job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &Job{
+		ID:        id,
+		OrderID:   request.Metadata.OrderID,
+		TxHash:    request.Metadata.TxHash,
+		Request:   &request,
+		Stage:     StageQueued,
+		Stages:    []StageTime{{Stage: StageQueued, Time: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// SetStage moves job to the stage
+func (j *Job) SetStage(stage Stage) {
+	now := time.Now().UTC()
+	j.Stage = stage
+	j.Stages = append(j.Stages, StageTime{Stage: stage, Time: now})
+	j.UpdatedAt = now
+}
+
+// Done returns true when job reached one of the final stages
+func (j *Job) Done() bool {
+	return j.Stage == StageCompleted || j.Stage == StageRefunded || j.Stage == StageFailed
+}
+
+// Reached returns true when job has ever entered the stage
+func (j *Job) Reached(stage Stage) bool {
+	for _, s := range j.Stages {
+		if s.Stage == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// NewLockOwner returns random ID of the owner of order lock
+func NewLockOwner() (string, error) {
+	return newID()
+}
+
+// ValidID returns true if id has format of job ID
+func ValidID(id string) bool {
+	return idRegexp.MatchString(id)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// clone returns deep copy of the job, so stored jobs can't be modified by callers
+func clone(job *Job) (*Job, error) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Job)
+	err = json.Unmarshal(b, c)
+	return c, err
+}
@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/monetha/ico-analyzer/types"
+)
+
+func testLocks(t *testing.T, store, other Store) {
+	now := time.Now()
+	if err := store.Lock(1, "a", now.Add(time.Minute)); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := other.Lock(1, "b", now.Add(time.Minute)); err != ErrLocked {
+		t.Errorf("Lock of locked order returned %v, want %v", err, ErrLocked)
+	}
+	if err := store.Lock(1, "a", now.Add(2*time.Minute)); err != nil {
+		t.Errorf("Lock extending own lock: %v", err)
+	}
+	if err := other.Lock(2, "b", now.Add(time.Minute)); err != nil {
+		t.Errorf("Lock of another order: %v", err)
+	}
+
+	// only the owner releases the lock
+	if err := other.Unlock(1, "b"); err != nil {
+		t.Errorf("Unlock by another owner: %v", err)
+	}
+	if err := other.Lock(1, "b", now.Add(time.Minute)); err != ErrLocked {
+		t.Errorf("Lock after unlock by another owner returned %v, want %v", err, ErrLocked)
+	}
+	if err := store.Unlock(1, "a"); err != nil {
+		t.Errorf("Unlock: %v", err)
+	}
+	if err := other.Lock(1, "b", now.Add(time.Minute)); err != nil {
+		t.Errorf("Lock of unlocked order: %v", err)
+	}
+
+	// expired lock is taken over
+	if err := store.Lock(3, "a", now.Add(-time.Second)); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := other.Lock(3, "b", now.Add(time.Minute)); err != nil {
+		t.Errorf("Lock of order with expired lock: %v", err)
+	}
+}
+
+// testConcurrentLock locks the order by many owners at once, only one of them gets the lock
+func testConcurrentLock(t *testing.T, stores ...Store) {
+	const owners = 20
+	results := make(chan error, owners)
+	for i := 0; i < owners; i++ {
+		go func(store Store, owner string) {
+			results <- store.Lock(4, owner, time.Now().Add(time.Minute))
+		}(stores[i%len(stores)], fmt.Sprintf("owner-%d", i))
+	}
+
+	var locked int
+	for i := 0; i < owners; i++ {
+		switch err := <-results; err {
+		case nil:
+			locked++
+		case ErrLocked:
+		default:
+			t.Errorf("Lock: %v", err)
+		}
+	}
+	if locked != 1 {
+		t.Errorf("%d of %d owners locked the order at once, want 1", locked, owners)
+	}
+}
+
+func testJobs(t *testing.T, store Store) {
+	request := types.ICOPassport{}
+	request.Metadata.OrderID = 7
+	request.Metadata.TxHash = "0x01"
+	job, err := New(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Create(job); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err = store.Create(job); err != ErrExists {
+		t.Errorf("Create of stored job returned %v, want %v", err, ErrExists)
+	}
+
+	job.WriteTxHash = "0x02"
+	job.PaymentTxHash = "0x03"
+	job.RefundTxHash = "0x04"
+	job.WithdrawTxHash = "0x05"
+	job.SetStage(StageProcessingPayment)
+	if err = store.Update(job); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	for _, get := range []func() (*Job, error){
+		func() (*Job, error) { return store.Get(job.ID) },
+		func() (*Job, error) { return store.FindByOrderID(7) },
+	} {
+		got, err := get()
+		if err != nil {
+			t.Fatalf("reading stored job: %v", err)
+		}
+		if got.ID != job.ID || got.TxHash != "0x01" || got.WriteTxHash != "0x02" || got.PaymentTxHash != "0x03" ||
+			got.RefundTxHash != "0x04" || got.WithdrawTxHash != "0x05" || got.Stage != StageProcessingPayment || !got.Reached(StageQueued) {
+			t.Errorf("stored job is %+v, want %+v", got, job)
+		}
+	}
+
+	unknown, _ := New(request)
+	if err = store.Update(unknown); err != ErrNotFound {
+		t.Errorf("Update of unknown job returned %v, want %v", err, ErrNotFound)
+	}
+	if _, err = store.Get(unknown.ID); err != ErrNotFound {
+		t.Errorf("Get of unknown job returned %v, want %v", err, ErrNotFound)
+	}
+	if _, err = store.FindByOrderID(8); err != ErrNotFound {
+		t.Errorf("FindByOrderID of unknown order returned %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testJobs(t, store)
+	testLocks(t, store, store)
+	testConcurrentLock(t, store)
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testJobs(t, store)
+
+	// stores of different processes share jobs and locks through the directory
+	other, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLocks(t, store, other)
+	testConcurrentLock(t, store, other)
+}
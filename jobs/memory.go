@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore stores jobs in memory
+type MemoryStore struct {
+	mu     sync.RWMutex
+	jobs   map[string]*Job
+	orders map[int64]string
+	locks  map[int64]orderLock
+}
+
+// NewMemoryStore creates empty in-memory job store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:   make(map[string]*Job),
+		orders: make(map[int64]string),
+		locks:  make(map[int64]orderLock),
+	}
+}
+
+// Create implements Store interface
+func (s *MemoryStore) Create(job *Job) error {
+	c, err := clone(job)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; ok {
+		return ErrExists
+	}
+	s.jobs[job.ID] = c
+	s.orders[job.OrderID] = job.ID
+	return nil
+}
+
+// Get implements Store interface
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.RLock()
+	job, ok := s.jobs[id]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(job)
+}
+
+// Update implements Store interface
+func (s *MemoryStore) Update(job *Job) error {
+	c, err := clone(job)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; !ok {
+		return ErrNotFound
+	}
+	s.jobs[job.ID] = c
+	return nil
+}
+
+// FindByOrderID implements Store interface
+func (s *MemoryStore) FindByOrderID(orderID int64) (*Job, error) {
+	s.mu.RLock()
+	id, ok := s.orders[orderID]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.Get(id)
+}
+
+// Lock implements Store interface
+func (s *MemoryStore) Lock(orderID int64, owner string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.locks[orderID]; ok && l.excludes(owner, time.Now()) {
+		return ErrLocked
+	}
+	s.locks[orderID] = orderLock{Owner: owner, Until: until}
+	return nil
+}
+
+// Unlock implements Store interface
+func (s *MemoryStore) Unlock(orderID int64, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.locks[orderID]; ok && l.Owner == owner {
+		delete(s.locks, orderID)
+	}
+	return nil
+}
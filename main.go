@@ -2,14 +2,15 @@ package main
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"math/big"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -18,21 +19,37 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	ethereum "github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/contracts/chequebook"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/monetha/ico-analyzer/analyser"
+	"github.com/monetha/ico-analyzer/blobs"
 	"github.com/monetha/ico-analyzer/blockchain"
 	"github.com/monetha/ico-analyzer/blockchain/contracts"
 	"github.com/monetha/ico-analyzer/config"
+	"github.com/monetha/ico-analyzer/jobs"
 	"github.com/monetha/ico-analyzer/types"
 )
 
 // ProcessingGasLimit a maximum gas limit to be used for payment processing operation
 const ProcessingGasLimit uint64 = 100000
 
+const (
+	jobsPath      = "/jobs/"
+	passportsPath = "/passports/"
+)
+
+var (
+	// lambdaMode is set when the process runs as Lambda function
+	lambdaMode bool
+
+	jobStore     jobs.Store
+	jobStoreErr  error
+	jobStoreOnce sync.Once
+)
+
 func init() {
 	path, found := os.LookupEnv("SSM_PS_PATH")
 	if found {
@@ -61,12 +78,62 @@ func init() {
 }
 
 func main() {
-	lambda.Start(router)
+	var (
+		httpAddr        string
+		tlsCertFile     string
+		tlsKeyFile      string
+		shutdownTimeout time.Duration
+	)
+	flag.StringVar(&httpAddr, "http", os.Getenv("HTTP_ADDR"), "run standalone HTTP server listening on the address instead of Lambda function (env HTTP_ADDR)")
+	flag.StringVar(&tlsCertFile, "tls-cert", os.Getenv("TLS_CERT_FILE"), "TLS certificate file of HTTP server (env TLS_CERT_FILE)")
+	flag.StringVar(&tlsKeyFile, "tls-key", os.Getenv("TLS_KEY_FILE"), "TLS private key file of HTTP server (env TLS_KEY_FILE)")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 15*time.Minute, "maximum time to wait for active requests and jobs on shutdown")
+	if len(os.Args) > 1 && (os.Args[1] == "analyse" || os.Args[1] == "analyze") {
+		if err := runAnalyseCommand(os.Args[2:]); err != nil {
+			log.Printf("error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		if err := runHistoryCommand(os.Args[2:]); err != nil {
+			log.Printf("error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	flag.Parse()
+
+	if httpAddr == "" {
+		lambdaMode = true
+		lambda.Start(handleLambda)
+		return
+	}
+
+	if err := serve(httpAddr, tlsCertFile, tlsKeyFile, shutdownTimeout); err != nil && err != http.ErrServerClosed {
+		log.Printf("error: HTTP server failed: %v", err)
+		os.Exit(1)
+	}
 }
 
 func router(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	switch req.HTTPMethod {
 	case "GET":
+		if strings.HasPrefix(req.Path, jobsPath) {
+			return getJob(req)
+		}
+		if strings.HasPrefix(req.Path, passportsPath) {
+			switch _, resource := passportResource(req); resource {
+			case "":
+				return getPassport(req)
+			case historyResource:
+				return getPassportHistory(req)
+			case diffResource:
+				return getPassportDiff(req)
+			}
+			return clientError(http.StatusNotFound)
+		}
 		return get(req)
 	case "POST":
 		return post(req)
@@ -114,135 +181,401 @@ func post(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, er
 		return clientError(http.StatusUnprocessableEntity)
 	}
 
-	ethClient, err := ethclient.Dial(config.EthereumJSONRPCURL)
+	// sections re-analyse only the listed stages of the passport in the request body
+	sections, err := analyser.ParseStages(req.QueryStringParameters["sections"])
 	if err != nil {
-		log.Printf("error: failed to dial JSON-RPC (%v): %v", config.EthereumJSONRPCURL, err)
-		return clientError(http.StatusInternalServerError)
+		log.Printf("error: invalid sections: %v", err)
+		return clientError(http.StatusBadRequest)
 	}
+
 	privateKey, err := crypto.HexToECDSA(config.MerchantKey)
 	if err != nil {
 		log.Printf("error: failed to parse ECDSA private key from the given key: %v", err)
 		return clientError(http.StatusInternalServerError)
 	}
 
-	err = runAnalyser(context.Background(), *data, ethClient, privateKey)
+	store, err := getJobStore()
 	if err != nil {
+		log.Printf("error: failed to open job store: %v", err)
 		return clientError(http.StatusInternalServerError)
 	}
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: http.StatusOK,
-		Headers: map[string]string{
-			"Access-Control-Allow-Origin": "*",
-		},
-		Body: fmt.Sprintf("ICO analysis successfully done for token address : %s for which payment is done by txn : %s", data.Metadata.TokenContractAddress, data.Metadata.TxHash),
-	}, nil
-}
+	ethClient, err := ethclient.Dial(config.EthereumJSONRPCURL)
+	if err != nil {
+		log.Printf("error: failed to dial JSON-RPC (%v): %v", config.EthereumJSONRPCURL, err)
+		return clientError(http.StatusInternalServerError)
+	}
+	defer ethClient.Close()
+	ctx := context.Background()
 
-func clientError(status int) (events.APIGatewayProxyResponse, error) {
-	return events.APIGatewayProxyResponse{
-		StatusCode: status,
-		Headers: map[string]string{
-			"Access-Control-Allow-Origin": "*",
+	paymentProcessor, err := contracts.NewPaymentProcessorContract(common.HexToAddress(config.PaymentProcessorAddress), ethClient)
+	if err != nil {
+		log.Printf("error: failed to create an instance of payment processor contract: %v", err)
+		return clientError(http.StatusInternalServerError)
+	}
+
+	h := &orderHandler{
+		store:  store,
+		orders: paymentProcessor,
+		passports: func() (passportFacts, error) {
+			blobStore, err := newBlobStore(config.BlobStore, config.BlobStoreDir, config.IPFSURL)
+			if err != nil {
+				return nil, err
+			}
+			return &chainPassports{ethClient: ethClient, privateKey: privateKey, reports: blobStore}, nil
 		},
-		Body: http.StatusText(status),
-	}, nil
+		start: func(job *jobs.Job, lockOwner string) error {
+			return startJob(store, job, lockOwner, privateKey)
+		},
+	}
+	return h.handle(ctx, data, sections)
 }
 
-func runAnalyser(ctx context.Context, data types.ICOPassport, ethClient *ethclient.Client, privateKey *ecdsa.PrivateKey) error {
-
-	transactOpts := bind.NewKeyedTransactor(privateKey)
+// orderHandler reserves the order of the request and starts its job, or responds with result of the processed order
+type orderHandler struct {
+	store  jobs.Store
+	orders orderReader
+	// passports opens passports of the merchant, it's needed only for finalized orders
+	passports func() (passportFacts, error)
+	// start starts the job holding the order lock
+	start func(job *jobs.Job, lockOwner string) error
+}
 
-	paymentProcessor, err := contracts.NewPaymentProcessorContract(common.HexToAddress(config.PaymentProcessorAddress), ethClient)
+func (h *orderHandler) handle(ctx context.Context, data *types.ICOPassport, sections []string) (events.APIGatewayProxyResponse, error) {
+	// order state is read before the order is reserved, so RPC calls don't block other requests
+	state, _, err := orderState(ctx, h.orders, data.Metadata.OrderID)
 	if err != nil {
-		log.Printf("error: failed to create an instance of payment processor contract: %v", err)
-		return err
+		log.Printf("error: failed to get order %d: %v", data.Metadata.OrderID, err)
+		return clientError(http.StatusInternalServerError)
 	}
 
-	if err := checkTx(ctx, ethClient, common.HexToHash(data.Metadata.TxHash), data.Metadata.OrderID, paymentProcessor); err != nil {
-		log.Printf("error: transaction %s processing failed: %v", data.Metadata.TxHash, err)
-		return err
+	job, err := h.store.FindByOrderID(data.Metadata.OrderID)
+	switch {
+	case err == jobs.ErrNotFound:
+		job = nil
+	case err != nil:
+		log.Printf("error: failed to find job for orderId %d: %v", data.Metadata.OrderID, err)
+		return clientError(http.StatusInternalServerError)
+	case job.Stage == jobs.StageCompleted || job.Stage == jobs.StageRefunded:
+		// order was already processed, the stored result is returned
+		return jsonResponse(http.StatusOK, job, map[string]string{"Location": jobsPath + job.ID})
 	}
 
-	transactOpts.GasLimit = ProcessingGasLimit
-	analysedData, icoRatingData, err := analyser.Run(ctx, &data)
-	if err != nil {
-		log.Printf("error: analyser failed calling RefundPayment for orderId %d: %v", data.Metadata.OrderID, err)
+	switch state {
+	case types.OrderStateNull, types.OrderStateCreated, types.OrderStateRefunded, types.OrderStateCancelled:
+		return orderConflict(&orderStateError{OrderID: data.Metadata.OrderID, State: state})
+	case types.OrderStateFinalized:
+		// payment of the order is already processed, the passport written before is returned
+		if job != nil && job.Passport != nil {
+			return jsonResponse(http.StatusOK, job.Passport, nil)
+		}
 
-		txn, err := paymentProcessor.RefundPayment(transactOpts, big.NewInt(data.Metadata.OrderID), 0, 0, big.NewInt(0), "error")
+		passports, err := h.passports()
 		if err != nil {
-			log.Printf("error: calling refund payment failed for orderId %d: %v", data.Metadata.OrderID, err)
-			return err
+			log.Printf("error: %v", err)
+			return clientError(http.StatusInternalServerError)
 		}
 
-		if err = waitForTx(ctx, ethClient, txn.Hash()); err != nil {
-			log.Printf("error: refund payment transaction %s failed for orderId %d: %v", txn.Hash(), data.Metadata.OrderID, err)
-			return err
+		icoPassport, err := passports.ReadPassport(ctx, common.HexToAddress(data.Metadata.PassportAddress))
+		if err == blockchain.ErrNoData {
+			return orderConflict(&orderStateError{OrderID: data.Metadata.OrderID, State: state})
 		}
-
-		txn, err = paymentProcessor.WithdrawRefund(transactOpts, big.NewInt(data.Metadata.OrderID))
 		if err != nil {
-			log.Printf("error: calling refund payment failed for orderId %d: %v", data.Metadata.OrderID, err)
-			return err
+			log.Printf("error: reading data from passport %s failed: %v", data.Metadata.PassportAddress, err)
+			return clientError(http.StatusInternalServerError)
 		}
+		return jsonResponse(http.StatusOK, icoPassport, nil)
+	}
 
-		if err = waitForTx(ctx, ethClient, txn.Hash()); err != nil {
-			log.Printf("error: withdraw refund payment transaction %s failed for orderId %d: %v", txn.Hash(), data.Metadata.OrderID, err)
+	// order lock is kept in the job store, so it holds across processes and Lambda containers sharing the store
+	lockOwner, err := jobs.NewLockOwner()
+	if err != nil {
+		log.Printf("error: failed to create order lock owner: %v", err)
+		return clientError(http.StatusInternalServerError)
+	}
+	err = h.store.Lock(data.Metadata.OrderID, lockOwner, time.Now().Add(orderLockTTL))
+	if err != nil && err != jobs.ErrLocked {
+		log.Printf("error: failed to lock order %d: %v", data.Metadata.OrderID, err)
+		return clientError(http.StatusInternalServerError)
+	}
+
+	// the job is re-read, it may be created or finished by a concurrent request
+	locked := err == jobs.ErrLocked
+	job, err = h.store.FindByOrderID(data.Metadata.OrderID)
+	switch {
+	case err == jobs.ErrNotFound && locked:
+		return clientError(http.StatusConflict)
+	case err == jobs.ErrNotFound:
+		job = nil
+	case err != nil:
+		log.Printf("error: failed to find job for orderId %d: %v", data.Metadata.OrderID, err)
+		unlockOrder(h.store, data.Metadata.OrderID, lockOwner)
+		return clientError(http.StatusInternalServerError)
+	case locked:
+		// order is being processed right now
+		return jsonResponse(http.StatusAccepted, job, map[string]string{"Location": jobsPath + job.ID})
+	case job.Stage == jobs.StageCompleted || job.Stage == jobs.StageRefunded:
+		unlockOrder(h.store, data.Metadata.OrderID, lockOwner)
+		return jsonResponse(http.StatusOK, job, map[string]string{"Location": jobsPath + job.ID})
+	}
+
+	if job == nil {
+		if job, err = jobs.New(*data); err != nil {
+			log.Printf("error: failed to create job for orderId %d: %v", data.Metadata.OrderID, err)
+			unlockOrder(h.store, data.Metadata.OrderID, lockOwner)
+			return clientError(http.StatusInternalServerError)
+		}
+		job.Sections = sections
+		if err = h.store.Create(job); err != nil {
+			log.Printf("error: failed to store job %s: %v", job.ID, err)
+			unlockOrder(h.store, job.OrderID, lockOwner)
+			return clientError(http.StatusInternalServerError)
+		}
+	} else {
+		// previous attempt did not finish, it is resumed from the last completed stage
+		log.Printf("resuming job %s for orderId %d from stage %s", job.ID, job.OrderID, job.Stage)
+		if job.Request == nil {
+			job.Request = data
 		}
-		return err
+		job.Error = ""
+		if err = h.store.Update(job); err != nil {
+			log.Printf("error: failed to update job %s: %v", job.ID, err)
+			unlockOrder(h.store, job.OrderID, lockOwner)
+			return clientError(http.StatusInternalServerError)
+		}
+	}
+
+	if err = h.start(job, lockOwner); err != nil {
+		log.Printf("error: failed to start job %s: %v", job.ID, err)
+		unlockOrder(h.store, job.OrderID, lockOwner)
+		return clientError(http.StatusInternalServerError)
 	}
 
-	icoPassport := getICOPassport(analysedData, icoRatingData, data)
-	icoPassportBytes, err := json.Marshal(icoPassport)
+	return jsonResponse(http.StatusAccepted, job, map[string]string{"Location": jobsPath + job.ID})
+}
+
+func getJob(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	err := config.Parse()
 	if err != nil {
-		log.Printf("error: marshaling icoPassport data into JSON failed: %v", err)
-		return err
+		log.Printf("error: failed to parse config: %v", err)
+		return clientError(http.StatusInternalServerError)
+	}
+
+	store, err := getJobStore()
+	if err != nil {
+		log.Printf("error: failed to open job store: %v", err)
+		return clientError(http.StatusInternalServerError)
+	}
+
+	id := req.PathParameters["id"]
+	if id == "" {
+		id = strings.TrimPrefix(req.Path, jobsPath)
+	}
+
+	job, err := store.Get(id)
+	if err == jobs.ErrNotFound {
+		return clientError(http.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("error: failed to get job %s: %v", id, err)
+		return clientError(http.StatusInternalServerError)
+	}
+
+	return jsonResponse(http.StatusOK, job, nil)
+}
+
+func getPassport(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	err := config.Parse()
+	if err != nil {
+		log.Printf("error: failed to parse config: %v", err)
+		return clientError(http.StatusInternalServerError)
 	}
 
-	fmt.Println(string(icoPassportBytes))
+	address, _ := passportResource(req)
+	if !common.IsHexAddress(address) {
+		return clientError(http.StatusBadRequest)
+	}
 
-	txHash, err := blockchain.WriteData(ctx, common.HexToAddress(data.Metadata.PassportAddress), ethClient, privateKey, icoPassportBytes)
+	privateKey, err := crypto.HexToECDSA(config.MerchantKey)
 	if err != nil {
-		log.Printf("error: writing data on passport %s failed: %v", data.Metadata.PassportAddress, err)
-		return err
+		log.Printf("error: failed to parse ECDSA private key from the given key: %v", err)
+		return clientError(http.StatusInternalServerError)
 	}
 
-	if err = waitForTx(ctx, ethClient, txHash); err != nil {
-		log.Printf("error: write to passport transaction %s failed: %v", txHash, err)
-		return err
+	ethClient, err := ethclient.Dial(config.EthereumJSONRPCURL)
+	if err != nil {
+		log.Printf("error: failed to dial JSON-RPC (%v): %v", config.EthereumJSONRPCURL, err)
+		return clientError(http.StatusInternalServerError)
 	}
+	defer ethClient.Close()
 
-	txn, err := paymentProcessor.ProcessPayment(transactOpts, big.NewInt(data.Metadata.OrderID), 0, 0, big.NewInt(0))
+	blobStore, err := newBlobStore(config.BlobStore, config.BlobStoreDir, config.IPFSURL)
 	if err != nil {
-		log.Printf("error: calling process payment failed for orderId %d: %v", data.Metadata.OrderID, err)
-		return err
+		log.Printf("error: %v", err)
+		return clientError(http.StatusInternalServerError)
+	}
+
+	factProvider := crypto.PubkeyToAddress(privateKey.PublicKey)
+	icoPassport, err := blockchain.ReadPassport(context.Background(), common.HexToAddress(address), factProvider, ethClient, blobStore)
+	if err == blockchain.ErrNoData {
+		return clientError(http.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("error: reading data from passport %s failed: %v", address, err)
+		return clientError(http.StatusInternalServerError)
+	}
+
+	return jsonResponse(http.StatusOK, icoPassport, nil)
+}
+
+func jsonResponse(status int, v interface{}, headers map[string]string) (events.APIGatewayProxyResponse, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("error: marshaling response into JSON failed: %v", err)
+		return clientError(http.StatusInternalServerError)
+	}
+
+	respHeaders := map[string]string{
+		"Access-Control-Allow-Origin": "*",
+		"Content-Type":                "application/json",
+	}
+	for k, v := range headers {
+		respHeaders[k] = v
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    respHeaders,
+		Body:       string(body),
+	}, nil
+}
+
+// orderStateResponse is the response body for orders which can't be processed in their current state
+type orderStateResponse struct {
+	Error   string `json:"error"`
+	OrderID int64  `json:"orderId"`
+	State   string `json:"state"`
+}
+
+// orderConflict responds with 409 Conflict explaining why the order can't be processed
+func orderConflict(err *orderStateError) (events.APIGatewayProxyResponse, error) {
+	return jsonResponse(http.StatusConflict, orderStateResponse{
+		Error:   err.Error(),
+		OrderID: err.OrderID,
+		State:   types.OrderStateName(err.State),
+	}, nil)
+}
+
+func clientError(status int) (events.APIGatewayProxyResponse, error) {
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: http.StatusText(status),
+	}, nil
+}
+
+// newAnalyser creates analyser which uses the chain explorer, rpcClient is used by JSON-RPC explorer only
+func newAnalyser(chainExplorer string, rpcClient *rpc.Client, fromBlock uint64, traceMode string, prices analyser.PriceOracle) *analyser.Analyser {
+	var explorer analyser.ChainExplorer = analyser.NewEtherScan()
+	if chainExplorer != config.ChainExplorerEtherScan {
+		jsonRPCExplorer := analyser.NewJSONRPCExplorer(ethclient.NewClient(rpcClient), rpcClient)
+		jsonRPCExplorer.FromBlock = fromBlock
+		jsonRPCExplorer.TraceMode = traceMode
+		explorer = jsonRPCExplorer
+	}
+
+	a := analyser.New(analyser.NewICORating(), explorer, prices)
+	a.Currencies = analyser.NewCoinGeckoRates()
+	if rpcClient != nil {
+		a.Tokens = analyser.NewERC20Reader(ethclient.NewClient(rpcClient))
 	}
+	return a
+}
 
-	if err = waitForTx(ctx, ethClient, txn.Hash()); err != nil {
-		log.Printf("error: process payment transaction %s failed for orderId %d: %v", txn.Hash(), data.Metadata.OrderID, err)
-		return err
+// loadExchanges returns built-in exchange addresses extended with addresses from the CSV file
+func loadExchanges(path string) (map[string]string, error) {
+	exchanges := make(map[string]string, len(analyser.DefaultExchanges))
+	for address, label := range analyser.DefaultExchanges {
+		exchanges[address] = label
+	}
+	if path == "" {
+		return exchanges, nil
 	}
 
-	return nil
+	fileExchanges, err := analyser.ReadExchanges(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange addresses from %s: %v", path, err)
+	}
+	for address, label := range fileExchanges {
+		exchanges[address] = label
+	}
+	return exchanges, nil
 }
 
-func checkTx(ctx context.Context, backend chequebook.Backend, txHash common.Hash, orderID int64, paymentProcessor *contracts.PaymentProcessorContract) (err error) {
-	if err = waitForTx(ctx, backend, txHash); err != nil {
-		return // Transaction Failed
+// newBlobStore creates blob store of full reports, nil is returned when kind is empty
+func newBlobStore(kind, dir, ipfsURL string) (blobs.Store, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case config.BlobStoreFile:
+		if lambdaMode {
+			// files written by a Lambda container are neither shared with other containers nor kept after it's stopped
+			return nil, errors.New("file blob store is supported only by HTTP server and CLI, use ipfs blob store with Lambda function")
+		}
+		store, err := blobs.NewFileStore(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open blob store %s: %v", dir, err)
+		}
+		return store, nil
+	case config.BlobStoreIPFS:
+		return blobs.NewIPFS(ipfsURL), nil
 	}
-	order, err := paymentProcessor.Orders(nil, big.NewInt(orderID))
+	return nil, fmt.Errorf("unsupported blob store %q", kind)
+}
+
+// loadScoreWeights returns trust score weights from the JSON file, built-in weights are returned when path is empty
+func loadScoreWeights(path string) (*analyser.ScoreWeights, error) {
+	if path == "" {
+		return analyser.DefaultScoreWeights, nil
+	}
+
+	weights, err := analyser.ReadScoreWeights(path)
 	if err != nil {
-		return
+		return nil, fmt.Errorf("failed to read score weights from %s: %v", path, err)
 	}
+	return weights, nil
+}
 
-	if order.State == types.OrderStateNull {
-		return fmt.Errorf("order with order id : %d does not exist", orderID)
+// newPriceOracle creates ETH/USD price oracle from the sources, median of the rates is taken when there are several sources
+func newPriceOracle(sources []string, csvFile string, coinGeckoURL string) (analyser.PriceOracle, error) {
+	var oracles analyser.MedianPrices
+	for _, source := range sources {
+		switch source {
+		case config.PriceSourcePoloniex:
+			oracles = append(oracles, analyser.NewPoloniex())
+		case config.PriceSourceCoinGecko:
+			coinGecko := analyser.NewCoinGecko()
+			if coinGeckoURL != "" {
+				coinGecko.URL = coinGeckoURL
+			}
+			oracles = append(oracles, coinGecko)
+		case config.PriceSourceCSV:
+			csvPrices, err := analyser.NewCSVPrices(csvFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ETH rates from %s: %v", csvFile, err)
+			}
+			oracles = append(oracles, csvPrices)
+		default:
+			return nil, fmt.Errorf("unsupported price source %q", source)
+		}
 	}
 
-	if order.State != types.OrderStatePaid {
-		return fmt.Errorf("order with order id : %d is not in paid state", orderID)
+	if len(oracles) == 1 {
+		return oracles[0], nil
 	}
-	return
+	return oracles, nil
 }
 
 func waitForTx(ctx context.Context, backend chequebook.Backend, txHash common.Hash) error {
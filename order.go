@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/contracts/chequebook"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/monetha/ico-analyzer/analyser"
+	"github.com/monetha/ico-analyzer/blobs"
+	"github.com/monetha/ico-analyzer/blockchain"
+	"github.com/monetha/ico-analyzer/blockchain/contracts"
+	"github.com/monetha/ico-analyzer/config"
+	"github.com/monetha/ico-analyzer/diff"
+	"github.com/monetha/ico-analyzer/jobs"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+// orderReader reads orders of the payment processor contract, it's implemented by contracts.PaymentProcessorContract
+type orderReader interface {
+	Orders(opts *bind.CallOpts, orderID *big.Int) (struct {
+		State           uint8
+		Price           *big.Int
+		Fee             *big.Int
+		PaymentAcceptor common.Address
+		OriginAddress   common.Address
+		TokenAddress    common.Address
+		VouchersApply   *big.Int
+		Discount        *big.Int
+	}, error)
+}
+
+// paymentProcessor is the payment processor contract orders are paid to, it's implemented by contracts.PaymentProcessorContract
+type paymentProcessor interface {
+	orderReader
+	ProcessPayment(opts *bind.TransactOpts, orderID *big.Int, clientReputation uint32, merchantReputation uint32, dealHash *big.Int) (*ethtypes.Transaction, error)
+	RefundPayment(opts *bind.TransactOpts, orderID *big.Int, clientReputation uint32, merchantReputation uint32, dealHash *big.Int, refundReason string) (*ethtypes.Transaction, error)
+	WithdrawRefund(opts *bind.TransactOpts, orderID *big.Int) (*ethtypes.Transaction, error)
+	WithdrawTokenRefund(opts *bind.TransactOpts, orderID *big.Int) (*ethtypes.Transaction, error)
+}
+
+// passportFacts writes ICO data of the fact provider to passports and reads it back
+type passportFacts interface {
+	// WriteData writes the data to the passport and returns hash of the transaction
+	WriteData(ctx context.Context, passport common.Address, data []byte) (common.Hash, error)
+	// VerifyData checks that the passport holds the data
+	VerifyData(ctx context.Context, passport common.Address, data []byte) error
+	// ReadPassport reads ICO passport written to the passport, blockchain.ErrNoData is returned when there is none
+	ReadPassport(ctx context.Context, passport common.Address) (*types.ICOPassport, error)
+	// LatestTxHash returns hash of transaction which wrote the current ICO data, blockchain.ErrNoData is returned when there is none
+	LatestTxHash(ctx context.Context, passport common.Address) (string, error)
+}
+
+// chainPassports is passportFacts of the merchant key on Ethereum network
+type chainPassports struct {
+	ethClient  *ethclient.Client
+	privateKey *ecdsa.PrivateKey
+	// reports keeps full ICO passports referenced by passport data, it's nil when passports hold the data itself
+	reports blobs.Store
+}
+
+func (c *chainPassports) factProvider() common.Address {
+	return crypto.PubkeyToAddress(c.privateKey.PublicKey)
+}
+
+func (c *chainPassports) WriteData(ctx context.Context, passport common.Address, data []byte) (common.Hash, error) {
+	return blockchain.WriteData(ctx, passport, c.ethClient, c.privateKey, data)
+}
+
+func (c *chainPassports) VerifyData(ctx context.Context, passport common.Address, data []byte) error {
+	return blockchain.VerifyData(ctx, passport, c.factProvider(), c.ethClient, data)
+}
+
+func (c *chainPassports) ReadPassport(ctx context.Context, passport common.Address) (*types.ICOPassport, error) {
+	return blockchain.ReadPassport(ctx, passport, c.factProvider(), c.ethClient, c.reports)
+}
+
+func (c *chainPassports) LatestTxHash(ctx context.Context, passport common.Address) (string, error) {
+	return blockchain.LatestTxHash(ctx, passport, c.factProvider(), c.ethClient, config.PassportStartBlock)
+}
+
+// orderProcessor moves the order through processing stages and records progress in the job,
+// every stage completed by a previous attempt is skipped, so the order can be safely processed again
+type orderProcessor struct {
+	ethClient        chequebook.Backend
+	analyser         *analyser.Analyser
+	paymentProcessor paymentProcessor
+	passports        passportFacts
+	transactOpts     *bind.TransactOpts
+	store            jobs.Store
+	job              *jobs.Job
+	// lockOwner holds the order lock, the lock is extended every time the job is saved
+	lockOwner string
+	// reports keeps full ICO passports when only references to them are written to the passport, it's nil otherwise
+	reports blobs.Store
+}
+
+func newOrderProcessor(ethClient *ethclient.Client, privateKey *ecdsa.PrivateKey, a *analyser.Analyser, store jobs.Store, job *jobs.Job, lockOwner string, reports blobs.Store) (*orderProcessor, error) {
+	paymentProcessor, err := contracts.NewPaymentProcessorContract(common.HexToAddress(config.PaymentProcessorAddress), ethClient)
+	if err != nil {
+		log.Printf("error: failed to create an instance of payment processor contract: %v", err)
+		return nil, err
+	}
+
+	transactOpts := bind.NewKeyedTransactor(privateKey)
+	transactOpts.GasLimit = ProcessingGasLimit
+
+	return &orderProcessor{
+		ethClient:        ethClient,
+		analyser:         a,
+		paymentProcessor: paymentProcessor,
+		passports:        &chainPassports{ethClient: ethClient, privateKey: privateKey, reports: reports},
+		transactOpts:     transactOpts,
+		store:            store,
+		job:              job,
+		lockOwner:        lockOwner,
+		reports:          reports,
+	}, nil
+}
+
+func (p *orderProcessor) save() {
+	if err := p.store.Update(p.job); err != nil {
+		log.Printf("error: failed to update job %s: %v", p.job.ID, err)
+	}
+	if err := p.store.Lock(p.job.OrderID, p.lockOwner, time.Now().Add(orderLockTTL)); err != nil {
+		log.Printf("error: failed to extend lock of order %d: %v", p.job.OrderID, err)
+	}
+}
+
+func (p *orderProcessor) setStage(stage jobs.Stage) {
+	p.job.SetStage(stage)
+	p.save()
+}
+
+// process runs the order processing pipeline, the on-chain order state is checked before any transaction is sent
+func (p *orderProcessor) process(ctx context.Context) error {
+	data := *p.job.Request
+	orderID := data.Metadata.OrderID
+
+	if !p.job.Reached(jobs.StagePaymentVerified) {
+		if err := waitForTx(ctx, p.ethClient, common.HexToHash(data.Metadata.TxHash)); err != nil {
+			log.Printf("error: transaction %s processing failed: %v", data.Metadata.TxHash, err)
+			return err
+		}
+	}
+
+	// the last transaction of a previous attempt may still be pending
+	if txHash := p.lastTxHash(); txHash != "" {
+		if err := waitForTx(ctx, p.ethClient, common.HexToHash(txHash)); err != nil {
+			log.Printf("warning: transaction %s of previous attempt for orderId %d failed: %v", txHash, orderID, err)
+		}
+	}
+
+	state, tokenAddress, err := orderState(ctx, p.paymentProcessor, orderID)
+	if err != nil {
+		log.Printf("error: failed to get order %d: %v", orderID, err)
+		return err
+	}
+
+	if tokenAddress != (common.Address{}) {
+		p.job.PaymentToken = tokenAddress.Hex()
+		p.save()
+	}
+
+	switch state {
+	case types.OrderStatePaid:
+		return p.processPaid(ctx, data)
+	case types.OrderStateFinalized:
+		return p.finalized(ctx, data)
+	case types.OrderStateRefunding:
+		return p.withdrawRefund(ctx, orderID)
+	case types.OrderStateRefunded:
+		if p.txSucceeded(ctx, p.job.WithdrawTxHash) {
+			// refund was withdrawn by a previous attempt
+			p.setStage(jobs.StageRefunded)
+			return nil
+		}
+	}
+	return &orderStateError{OrderID: orderID, State: state}
+}
+
+// finalized completes the job of the order which payment is already processed, the passport written before is used as the result
+func (p *orderProcessor) finalized(ctx context.Context, data types.ICOPassport) error {
+	if p.job.Passport == nil {
+		icoPassport, err := p.passports.ReadPassport(ctx, common.HexToAddress(data.Metadata.PassportAddress))
+		if err != nil {
+			log.Printf("error: reading data from passport %s of finalized orderId %d failed: %v", data.Metadata.PassportAddress, data.Metadata.OrderID, err)
+			return err
+		}
+		p.job.Passport = icoPassport
+	}
+
+	p.setStage(jobs.StageCompleted)
+	return nil
+}
+
+// processPaid analyses ICO, writes the result to the passport and processes payment of the paid order
+func (p *orderProcessor) processPaid(ctx context.Context, data types.ICOPassport) (err error) {
+	orderID := data.Metadata.OrderID
+	if !p.job.Reached(jobs.StagePaymentVerified) {
+		p.setStage(jobs.StagePaymentVerified)
+	}
+
+	if p.job.Passport == nil {
+		p.setStage(jobs.StageAnalysing)
+		analysedData, icoRatingData, err := p.analyser.RunStages(ctx, &data, analyser.Options{Stages: p.job.Sections})
+		if err != nil {
+			log.Printf("error: analyser failed calling RefundPayment for orderId %d: %v", orderID, err)
+			p.job.Error = err.Error()
+			p.job.RefundReason = string(analyser.ReasonOf(err))
+			p.save()
+			if refundErr := p.refund(ctx, orderID); refundErr != nil {
+				return refundErr
+			}
+			return err
+		}
+
+		icoPassport := getICOPassport(analysedData, icoRatingData, data)
+		icoPassport.Metadata.PreviousTxHash = p.previousTxHash(ctx, data.Metadata.PassportAddress)
+		if len(p.job.Sections) > 0 {
+			if p.job.Changes, err = diff.JSON(p.job.Request, icoPassport); err != nil {
+				log.Printf("warning: failed to compare re-analysed passport with the request for orderId %d: %v", orderID, err)
+			}
+		}
+		p.job.Passport = &icoPassport
+		p.save()
+	}
+
+	icoPassportBytes, err := p.factData(ctx)
+	if err != nil {
+		log.Printf("error: preparing passport data failed: %v", err)
+		return
+	}
+
+	passportAddress := common.HexToAddress(data.Metadata.PassportAddress)
+	if !p.txSucceeded(ctx, p.job.WriteTxHash) {
+		if config.PassportFormat != config.PassportFormatCBOR {
+			fmt.Println(string(icoPassportBytes))
+		}
+
+		p.setStage(jobs.StageWritingPassport)
+		txHash, err := p.passports.WriteData(ctx, passportAddress, icoPassportBytes)
+		if err != nil {
+			log.Printf("error: writing data on passport %s failed: %v", data.Metadata.PassportAddress, err)
+			return err
+		}
+		p.job.WriteTxHash = txHash.Hex()
+		p.save()
+
+		if err = waitForTx(ctx, p.ethClient, txHash); err != nil {
+			log.Printf("error: write to passport transaction %s failed: %v", txHash, err)
+			return err
+		}
+	}
+
+	if err = p.passports.VerifyData(ctx, passportAddress, icoPassportBytes); err != nil {
+		log.Printf("error: verification of data written to passport %s failed: %v", data.Metadata.PassportAddress, err)
+		return
+	}
+
+	// the payment processor transfers ETH or ERC20 token of the order itself
+	p.setStage(jobs.StageProcessingPayment)
+	txn, err := p.paymentProcessor.ProcessPayment(p.transactOpts, big.NewInt(orderID), 0, 0, big.NewInt(0))
+	if err != nil {
+		log.Printf("error: calling process payment failed for orderId %d: %v", orderID, err)
+		return
+	}
+	p.job.PaymentTxHash = txn.Hash().Hex()
+	p.save()
+
+	if err = waitForTx(ctx, p.ethClient, txn.Hash()); err != nil {
+		log.Printf("error: process payment transaction %s failed for orderId %d: %v", txn.Hash(), orderID, err)
+		return
+	}
+
+	p.setStage(jobs.StageCompleted)
+	return
+}
+
+// factData returns data written to the passport, it's the ICO passport or reference to it when the passport is kept
+// in blob store, encoded in the configured format; the same data is returned for the same ICO passport
+func (p *orderProcessor) factData(ctx context.Context) ([]byte, error) {
+	format := blockchain.Format(config.PassportFormat)
+	if p.reports == nil {
+		return blockchain.EncodeFact(p.job.Passport, format)
+	}
+
+	ref, err := blockchain.StoreReport(ctx, p.reports, config.BlobStore, p.job.Passport)
+	if err != nil {
+		return nil, err
+	}
+	return blockchain.EncodeFact(ref, format)
+}
+
+// previousTxHash returns hash of transaction which wrote the current ICO data to the passport, empty for the first write
+func (p *orderProcessor) previousTxHash(ctx context.Context, passportAddress string) string {
+	txHash, err := p.passports.LatestTxHash(ctx, common.HexToAddress(passportAddress))
+	if err != nil && err != blockchain.ErrNoData {
+		log.Printf("warning: failed to find previous ICO data of passport %s: %v", passportAddress, err)
+	}
+	return txHash
+}
+
+// refund refunds payment of the paid order with the job refund reason and withdraws the refund to the client
+func (p *orderProcessor) refund(ctx context.Context, orderID int64) error {
+	txn, err := p.paymentProcessor.RefundPayment(p.transactOpts, big.NewInt(orderID), 0, 0, big.NewInt(0), p.job.RefundReason)
+	if err != nil {
+		log.Printf("error: calling refund payment failed for orderId %d: %v", orderID, err)
+		return err
+	}
+	p.job.RefundTxHash = txn.Hash().Hex()
+	p.save()
+
+	if err = waitForTx(ctx, p.ethClient, txn.Hash()); err != nil {
+		log.Printf("error: refund payment transaction %s failed for orderId %d: %v", txn.Hash(), orderID, err)
+		return err
+	}
+
+	return p.withdrawRefund(ctx, orderID)
+}
+
+// withdrawRefund withdraws refund of the order to the client, orders paid with ERC20 token are refunded in the same token
+func (p *orderProcessor) withdrawRefund(ctx context.Context, orderID int64) error {
+	if !p.txSucceeded(ctx, p.job.WithdrawTxHash) {
+		withdraw := p.paymentProcessor.WithdrawRefund
+		if p.job.PaymentToken != "" {
+			log.Printf("withdrawing token %s refund for orderId %d", p.job.PaymentToken, orderID)
+			withdraw = p.paymentProcessor.WithdrawTokenRefund
+		}
+
+		txn, err := withdraw(p.transactOpts, big.NewInt(orderID))
+		if err != nil {
+			log.Printf("error: calling refund payment failed for orderId %d: %v", orderID, err)
+			return err
+		}
+		p.job.WithdrawTxHash = txn.Hash().Hex()
+		p.save()
+
+		if err = waitForTx(ctx, p.ethClient, txn.Hash()); err != nil {
+			log.Printf("error: withdraw refund payment transaction %s failed for orderId %d: %v", txn.Hash(), orderID, err)
+			return err
+		}
+	}
+
+	p.setStage(jobs.StageRefunded)
+	return nil
+}
+
+// lastTxHash returns hash of the last transaction sent for the order
+func (p *orderProcessor) lastTxHash() string {
+	for _, txHash := range []string{p.job.WithdrawTxHash, p.job.RefundTxHash, p.job.PaymentTxHash, p.job.WriteTxHash} {
+		if txHash != "" {
+			return txHash
+		}
+	}
+	return ""
+}
+
+// txSucceeded returns true if transaction is mined and succeeded
+func (p *orderProcessor) txSucceeded(ctx context.Context, txHash string) bool {
+	if txHash == "" {
+		return false
+	}
+
+	tr, err := p.ethClient.TransactionReceipt(ctx, common.HexToHash(txHash))
+	return err == nil && tr.Status == types.ReceiptStatusSuccessful
+}
+
+// orderStateError is returned when the order can't be processed in its current state
+type orderStateError struct {
+	OrderID int64
+	State   uint8
+}
+
+func (e *orderStateError) Error() string {
+	switch e.State {
+	case types.OrderStateNull:
+		return fmt.Sprintf("order with order id : %d does not exist", e.OrderID)
+	case types.OrderStateCreated:
+		return fmt.Sprintf("order with order id : %d is not paid", e.OrderID)
+	}
+	return fmt.Sprintf("order with order id : %d is %s", e.OrderID, types.OrderStateName(e.State))
+}
+
+// orderState reads state of the order and address of the token it's paid with from the payment processor contract,
+// token address is zero for orders paid with ETH
+func orderState(ctx context.Context, orders orderReader, orderID int64) (state uint8, tokenAddress common.Address, err error) {
+	order, err := orders.Orders(&bind.CallOpts{Context: ctx}, big.NewInt(orderID))
+	if err != nil {
+		return
+	}
+	state = order.State
+	tokenAddress = order.TokenAddress
+	return
+}
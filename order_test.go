@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/contracts/chequebook"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/monetha/ico-analyzer/blockchain"
+	"github.com/monetha/ico-analyzer/config"
+	"github.com/monetha/ico-analyzer/jobs"
+	"github.com/monetha/ico-analyzer/types"
+)
+
+const testOrderID = 7
+
+var (
+	testPassport = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	testToken    = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+)
+
+// fakeChain is Ethereum backend which mines every transaction at once
+type fakeChain struct {
+	chequebook.Backend
+	nonce    uint64
+	receipts map[common.Hash]*ethtypes.Receipt
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{receipts: make(map[common.Hash]*ethtypes.Receipt)}
+}
+
+// send returns new transaction mined with the status
+func (c *fakeChain) send(status uint64) *ethtypes.Transaction {
+	c.nonce++
+	tx := ethtypes.NewTransaction(c.nonce, common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil)
+	c.receipts[tx.Hash()] = &ethtypes.Receipt{Status: status}
+	return tx
+}
+
+func (c *fakeChain) TransactionReceipt(ctx context.Context, txHash common.Hash) (*ethtypes.Receipt, error) {
+	if r, ok := c.receipts[txHash]; ok {
+		return r, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (c *fakeChain) Commit() {}
+
+// fakeOrder is order of fakePaymentProcessor
+type fakeOrder struct {
+	state uint8
+	token common.Address
+}
+
+// fakePaymentProcessor moves orders between states like the payment processor contract and records called transactions
+type fakePaymentProcessor struct {
+	chain  *fakeChain
+	orders map[int64]*fakeOrder
+	calls  []string
+}
+
+func newFakePaymentProcessor(chain *fakeChain, state uint8) *fakePaymentProcessor {
+	return &fakePaymentProcessor{
+		chain:  chain,
+		orders: map[int64]*fakeOrder{testOrderID: {state: state}},
+	}
+}
+
+func (p *fakePaymentProcessor) Orders(opts *bind.CallOpts, orderID *big.Int) (order struct {
+	State           uint8
+	Price           *big.Int
+	Fee             *big.Int
+	PaymentAcceptor common.Address
+	OriginAddress   common.Address
+	TokenAddress    common.Address
+	VouchersApply   *big.Int
+	Discount        *big.Int
+}, err error) {
+	if o, ok := p.orders[orderID.Int64()]; ok {
+		order.State = o.state
+		order.TokenAddress = o.token
+	}
+	return
+}
+
+func (p *fakePaymentProcessor) transact(name string, orderID *big.Int, from, to uint8) (*ethtypes.Transaction, error) {
+	p.calls = append(p.calls, name)
+	o, ok := p.orders[orderID.Int64()]
+	if !ok || o.state != from {
+		return nil, fmt.Errorf("%s reverted for order %v", name, orderID)
+	}
+	o.state = to
+	return p.chain.send(types.ReceiptStatusSuccessful), nil
+}
+
+func (p *fakePaymentProcessor) ProcessPayment(opts *bind.TransactOpts, orderID *big.Int, clientReputation uint32, merchantReputation uint32, dealHash *big.Int) (*ethtypes.Transaction, error) {
+	return p.transact("ProcessPayment", orderID, types.OrderStatePaid, types.OrderStateFinalized)
+}
+
+func (p *fakePaymentProcessor) RefundPayment(opts *bind.TransactOpts, orderID *big.Int, clientReputation uint32, merchantReputation uint32, dealHash *big.Int, refundReason string) (*ethtypes.Transaction, error) {
+	return p.transact("RefundPayment", orderID, types.OrderStatePaid, types.OrderStateRefunding)
+}
+
+func (p *fakePaymentProcessor) WithdrawRefund(opts *bind.TransactOpts, orderID *big.Int) (*ethtypes.Transaction, error) {
+	return p.transact("WithdrawRefund", orderID, types.OrderStateRefunding, types.OrderStateRefunded)
+}
+
+func (p *fakePaymentProcessor) WithdrawTokenRefund(opts *bind.TransactOpts, orderID *big.Int) (*ethtypes.Transaction, error) {
+	return p.transact("WithdrawTokenRefund", orderID, types.OrderStateRefunding, types.OrderStateRefunded)
+}
+
+// fakePassports keeps data written to passports in memory, passport is read from finalized orders
+type fakePassports struct {
+	chain    *fakeChain
+	data     map[common.Address][]byte
+	passport *types.ICOPassport
+	writes   int
+}
+
+func newFakePassports(chain *fakeChain) *fakePassports {
+	return &fakePassports{chain: chain, data: make(map[common.Address][]byte)}
+}
+
+func (f *fakePassports) WriteData(ctx context.Context, passport common.Address, data []byte) (common.Hash, error) {
+	f.writes++
+	f.data[passport] = data
+	return f.chain.send(types.ReceiptStatusSuccessful).Hash(), nil
+}
+
+func (f *fakePassports) VerifyData(ctx context.Context, passport common.Address, data []byte) error {
+	if !bytes.Equal(f.data[passport], data) {
+		return blockchain.ErrDataMismatch
+	}
+	return nil
+}
+
+func (f *fakePassports) ReadPassport(ctx context.Context, passport common.Address) (*types.ICOPassport, error) {
+	if f.passport == nil {
+		return nil, blockchain.ErrNoData
+	}
+	return f.passport, nil
+}
+
+func (f *fakePassports) LatestTxHash(ctx context.Context, passport common.Address) (string, error) {
+	return "", blockchain.ErrNoData
+}
+
+// testRequest returns analysis request of the test order paid by the transaction
+func testRequest(txHash common.Hash) *types.ICOPassport {
+	data := new(types.ICOPassport)
+	data.Metadata.OrderID = testOrderID
+	data.Metadata.TxHash = txHash.Hex()
+	data.Metadata.PassportAddress = testPassport.Hex()
+	return data
+}
+
+func TestOrderProcessor(t *testing.T) {
+	config.PassportFormat = config.PassportFormatJSON
+	result := &types.ICOPassport{}
+	result.Metadata.OrderID = testOrderID
+
+	tests := []struct {
+		name       string
+		state      uint8
+		token      common.Address
+		prepare    func(job *jobs.Job, chain *fakeChain, passports *fakePassports)
+		wantCalls  []string
+		wantWrites int
+		wantStage  jobs.Stage
+		wantErr    bool
+	}{
+		{
+			name:  "paid order resumed after succeeded write",
+			state: types.OrderStatePaid,
+			prepare: func(job *jobs.Job, chain *fakeChain, passports *fakePassports) {
+				job.Passport = result
+				job.WriteTxHash = chain.send(types.ReceiptStatusSuccessful).Hash().Hex()
+				passports.data[testPassport], _ = blockchain.EncodeFact(result, blockchain.Format(config.PassportFormatJSON))
+			},
+			wantCalls: []string{"ProcessPayment"},
+			wantStage: jobs.StageCompleted,
+		},
+		{
+			name:  "paid order resumed after failed write",
+			state: types.OrderStatePaid,
+			prepare: func(job *jobs.Job, chain *fakeChain, passports *fakePassports) {
+				job.Passport = result
+				job.WriteTxHash = chain.send(types.ReceiptStatusFailed).Hash().Hex()
+			},
+			wantCalls:  []string{"ProcessPayment"},
+			wantWrites: 1,
+			wantStage:  jobs.StageCompleted,
+		},
+		{
+			name:  "refunding order resumed after refund",
+			state: types.OrderStateRefunding,
+			prepare: func(job *jobs.Job, chain *fakeChain, passports *fakePassports) {
+				job.RefundTxHash = chain.send(types.ReceiptStatusSuccessful).Hash().Hex()
+			},
+			wantCalls: []string{"WithdrawRefund"},
+			wantStage: jobs.StageRefunded,
+		},
+		{
+			name:  "refunding order paid with token",
+			state: types.OrderStateRefunding,
+			token: testToken,
+			prepare: func(job *jobs.Job, chain *fakeChain, passports *fakePassports) {
+				job.RefundTxHash = chain.send(types.ReceiptStatusSuccessful).Hash().Hex()
+			},
+			wantCalls: []string{"WithdrawTokenRefund"},
+			wantStage: jobs.StageRefunded,
+		},
+		{
+			name:  "refunded order resumed after withdrawal",
+			state: types.OrderStateRefunded,
+			prepare: func(job *jobs.Job, chain *fakeChain, passports *fakePassports) {
+				job.RefundTxHash = chain.send(types.ReceiptStatusSuccessful).Hash().Hex()
+				job.WithdrawTxHash = chain.send(types.ReceiptStatusSuccessful).Hash().Hex()
+			},
+			wantStage: jobs.StageRefunded,
+		},
+		{
+			name:      "refunded order not withdrawn by the job",
+			state:     types.OrderStateRefunded,
+			wantStage: jobs.StagePaymentVerified,
+			wantErr:   true,
+		},
+		{
+			name:  "finalized order",
+			state: types.OrderStateFinalized,
+			prepare: func(job *jobs.Job, chain *fakeChain, passports *fakePassports) {
+				passports.passport = result
+			},
+			wantStage: jobs.StageCompleted,
+		},
+		{
+			name:      "cancelled order",
+			state:     types.OrderStateCancelled,
+			wantStage: jobs.StagePaymentVerified,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		chain := newFakeChain()
+		paymentProcessor := newFakePaymentProcessor(chain, tt.state)
+		paymentProcessor.orders[testOrderID].token = tt.token
+		passports := newFakePassports(chain)
+
+		job, err := jobs.New(*testRequest(chain.send(types.ReceiptStatusSuccessful).Hash()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.SetStage(jobs.StagePaymentVerified)
+		if tt.prepare != nil {
+			tt.prepare(job, chain, passports)
+		}
+		store := jobs.NewMemoryStore()
+		if err = store.Create(job); err != nil {
+			t.Fatal(err)
+		}
+
+		p := &orderProcessor{
+			ethClient:        chain,
+			paymentProcessor: paymentProcessor,
+			passports:        passports,
+			transactOpts:     new(bind.TransactOpts),
+			store:            store,
+			job:              job,
+			lockOwner:        "test",
+		}
+		err = p.process(context.Background())
+		if _, ok := err.(*orderStateError); ok != tt.wantErr || (err != nil && !tt.wantErr) {
+			t.Errorf("%s: process returned %v, want order state error %v", tt.name, err, tt.wantErr)
+		}
+		if job.Stage != tt.wantStage {
+			t.Errorf("%s: process moved job to stage %s, want %s", tt.name, job.Stage, tt.wantStage)
+		}
+		if !reflect.DeepEqual(paymentProcessor.calls, tt.wantCalls) {
+			t.Errorf("%s: process called %v, want %v", tt.name, paymentProcessor.calls, tt.wantCalls)
+		}
+		if passports.writes != tt.wantWrites {
+			t.Errorf("%s: process wrote passport %d times, want %d", tt.name, passports.writes, tt.wantWrites)
+		}
+		if tt.wantStage == jobs.StageCompleted && job.Passport != result {
+			t.Errorf("%s: process returned passport %+v, want %+v", tt.name, job.Passport, result)
+		}
+		if tt.token != (common.Address{}) && job.PaymentToken != tt.token.Hex() {
+			t.Errorf("%s: process set payment token %q, want %q", tt.name, job.PaymentToken, tt.token.Hex())
+		}
+	}
+}
+
+// testHandler is orderHandler of the test order which records started jobs
+type testHandler struct {
+	*orderHandler
+	started []*jobs.Job
+}
+
+func newTestHandler(state uint8, passports *fakePassports) *testHandler {
+	h := new(testHandler)
+	h.orderHandler = &orderHandler{
+		store:  jobs.NewMemoryStore(),
+		orders: newFakePaymentProcessor(newFakeChain(), state),
+		passports: func() (passportFacts, error) {
+			return passports, nil
+		},
+		start: func(job *jobs.Job, lockOwner string) error {
+			h.started = append(h.started, job)
+			return nil
+		},
+	}
+	return h
+}
+
+func TestOrderHandlerConflicts(t *testing.T) {
+	for _, state := range []uint8{types.OrderStateNull, types.OrderStateCreated, types.OrderStateRefunded, types.OrderStateCancelled, types.OrderStateFinalized} {
+		// finalized order conflicts when its passport has no ICO data
+		h := newTestHandler(state, newFakePassports(newFakeChain()))
+		resp, err := h.handle(context.Background(), testRequest(common.Hash{}), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("order %s: handle responded with %d, want %d", types.OrderStateName(state), resp.StatusCode, http.StatusConflict)
+		}
+		var body orderStateResponse
+		if err = json.Unmarshal([]byte(resp.Body), &body); err != nil || body.State != types.OrderStateName(state) || body.OrderID != testOrderID {
+			t.Errorf("order %s: handle responded with %s, want order state", types.OrderStateName(state), resp.Body)
+		}
+		if len(h.started) > 0 {
+			t.Errorf("order %s: handle started job", types.OrderStateName(state))
+		}
+		if _, err = h.store.FindByOrderID(testOrderID); err != jobs.ErrNotFound {
+			t.Errorf("order %s: FindByOrderID returned %v, want %v", types.OrderStateName(state), err, jobs.ErrNotFound)
+		}
+	}
+}
+
+func TestOrderHandlerFinalized(t *testing.T) {
+	passports := newFakePassports(newFakeChain())
+	passports.passport = &types.ICOPassport{}
+	passports.passport.Metadata.OrderID = testOrderID
+	h := newTestHandler(types.OrderStateFinalized, passports)
+
+	resp, err := h.handle(context.Background(), testRequest(common.Hash{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body types.ICOPassport
+	if resp.StatusCode != http.StatusOK || json.Unmarshal([]byte(resp.Body), &body) != nil || body.Metadata.OrderID != testOrderID {
+		t.Errorf("handle responded with %d %s, want passport of the order", resp.StatusCode, resp.Body)
+	}
+	if len(h.started) > 0 {
+		t.Error("handle started job of finalized order")
+	}
+}
+
+func TestOrderHandlerPaid(t *testing.T) {
+	h := newTestHandler(types.OrderStatePaid, nil)
+	resp, err := h.handle(context.Background(), testRequest(common.Hash{}), []string{"checks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted || len(h.started) != 1 {
+		t.Fatalf("handle responded with %d and started %d jobs, want %d and 1 job", resp.StatusCode, len(h.started), http.StatusAccepted)
+	}
+	job := h.started[0]
+	if resp.Headers["Location"] != jobsPath+job.ID || !reflect.DeepEqual(job.Sections, []string{"checks"}) {
+		t.Errorf("handle started job %+v at %s", job, resp.Headers["Location"])
+	}
+
+	// the started job holds the order lock, the next request gets the job without starting another one
+	resp, err = h.handle(context.Background(), testRequest(common.Hash{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted || resp.Headers["Location"] != jobsPath+job.ID || len(h.started) != 1 {
+		t.Errorf("handle of locked order responded with %d at %s and started %d jobs, want %d at %s and 1 job",
+			resp.StatusCode, resp.Headers["Location"], len(h.started), http.StatusAccepted, jobsPath+job.ID)
+	}
+}
+
+func TestOrderHandlerLockedWithoutJob(t *testing.T) {
+	h := newTestHandler(types.OrderStatePaid, nil)
+	if err := h.store.Lock(testOrderID, "other", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := h.handle(context.Background(), testRequest(common.Hash{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusConflict || len(h.started) > 0 {
+		t.Errorf("handle responded with %d and started %d jobs, want %d", resp.StatusCode, len(h.started), http.StatusConflict)
+	}
+}
+
+func TestOrderHandlerResumesJob(t *testing.T) {
+	h := newTestHandler(types.OrderStatePaid, nil)
+	job, err := jobs.New(*testRequest(common.Hash{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.WriteTxHash = "0x01"
+	job.Error = "write to passport transaction failed"
+	job.SetStage(jobs.StageFailed)
+	if err = h.store.Create(job); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := h.handle(context.Background(), testRequest(common.Hash{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted || len(h.started) != 1 {
+		t.Fatalf("handle responded with %d and started %d jobs, want %d and 1 job", resp.StatusCode, len(h.started), http.StatusAccepted)
+	}
+	if resumed := h.started[0]; resumed.ID != job.ID || resumed.WriteTxHash != "0x01" || resumed.Error != "" {
+		t.Errorf("handle started job %+v, want job %s resumed", resumed, job.ID)
+	}
+}
+
+func TestOrderHandlerCompleted(t *testing.T) {
+	for _, stage := range []jobs.Stage{jobs.StageCompleted, jobs.StageRefunded} {
+		h := newTestHandler(types.OrderStateFinalized, nil)
+		job, err := jobs.New(*testRequest(common.Hash{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.SetStage(stage)
+		if err = h.store.Create(job); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := h.handle(context.Background(), testRequest(common.Hash{}), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Headers["Location"] != jobsPath+job.ID || len(h.started) > 0 {
+			t.Errorf("%s job: handle responded with %d at %s and started %d jobs, want %d at %s",
+				stage, resp.StatusCode, resp.Headers["Location"], len(h.started), http.StatusOK, jobsPath+job.ID)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const maxRequestBodySize = 1 << 20
+
+// runningJobs tracks background jobs, so server can wait for them on shutdown
+var runningJobs sync.WaitGroup
+
+// apiGatewayHandler adapts API Gateway proxy handler to net/http handler
+type apiGatewayHandler func(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// ServeHTTP implements http.Handler interface
+func (h apiGatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for k, v := range r.Header {
+		headers[k] = v[0]
+	}
+
+	query := make(map[string]string)
+	for k, v := range r.URL.Query() {
+		query[k] = v[0]
+	}
+
+	resp, err := h(events.APIGatewayProxyRequest{
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         headers,
+		MultiValueHeaders:               r.Header,
+		QueryStringParameters:           query,
+		MultiValueQueryStringParameters: r.URL.Query(),
+		Body:                            string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			HTTPMethod: r.Method,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  r.RemoteAddr,
+				UserAgent: r.UserAgent(),
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("error: handling %s %s failed: %v", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	respBody := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		if respBody, err = base64.StdEncoding.DecodeString(resp.Body); err != nil {
+			log.Printf("error: decoding response body of %s %s failed: %v", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+	}
+
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := w.Write(respBody); err != nil {
+		log.Printf("error: writing response of %s %s failed: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// serve runs HTTP server until SIGINT or SIGTERM is received, then waits for active requests and background jobs
+func serve(addr, certFile, keyFile string, shutdownTimeout time.Duration) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           apiGatewayHandler(router),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", addr)
+		if certFile != "" || keyFile != "" {
+			errc <- srv.ListenAndServeTLS(certFile, keyFile)
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-sigc:
+		log.Printf("received %v, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	jobsDone := make(chan struct{})
+	go func() {
+		runningJobs.Wait()
+		close(jobsDone)
+	}()
+
+	select {
+	case <-jobsDone:
+		return nil
+	case <-ctx.Done():
+		log.Printf("warning: shutdown timeout exceeded, running jobs are interrupted")
+		return ctx.Err()
+	}
+}
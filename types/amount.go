@@ -0,0 +1,108 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// maxAmountPrecision limits number of fractional digits of amounts which are not exact decimals
+const maxAmountPrecision = 36
+
+var ten = big.NewInt(10)
+
+// Amount is exact amount of ETH or tokens, it's encoded in JSON as decimal string, zero value is zero amount
+type Amount struct {
+	rat *big.Rat
+}
+
+// NewAmount creates amount from integer value in the smallest units (wei, token base units) and the number of decimals
+func NewAmount(value *big.Int, decimals int) Amount {
+	if value == nil {
+		return Amount{}
+	}
+	r := new(big.Rat).SetInt(value)
+	if decimals > 0 {
+		r.Quo(r, new(big.Rat).SetInt(new(big.Int).Exp(ten, big.NewInt(int64(decimals)), nil)))
+	}
+	return Amount{rat: r}
+}
+
+// ParseAmount parses decimal string
+func ParseAmount(s string) (a Amount, err error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		err = fmt.Errorf("invalid amount %q", s)
+		return
+	}
+	a.rat = r
+	return
+}
+
+// Rat returns copy of the amount
+func (a Amount) Rat() *big.Rat {
+	if a.rat == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(a.rat)
+}
+
+// Add returns sum of the amounts
+func (a Amount) Add(b Amount) Amount {
+	return Amount{rat: new(big.Rat).Add(a.Rat(), b.Rat())}
+}
+
+// Cmp compares the amounts and returns -1, 0 or +1
+func (a Amount) Cmp(b Amount) int {
+	return a.Rat().Cmp(b.Rat())
+}
+
+// Sign returns -1, 0 or +1 depending on sign of the amount
+func (a Amount) Sign() int {
+	if a.rat == nil {
+		return 0
+	}
+	return a.rat.Sign()
+}
+
+// Float64 returns the nearest float value, it's used only for calculations with prices and rates
+func (a Amount) Float64() float64 {
+	f, _ := a.Rat().Float64()
+	return f
+}
+
+// String returns exact decimal representation without trailing zeros
+func (a Amount) String() string {
+	r := a.Rat()
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// amounts created from integers are exact decimals, the precision is the smallest power of 10 divisible by denominator
+	precision, pow := 0, big.NewInt(1)
+	for precision < maxAmountPrecision && new(big.Int).Mod(pow, r.Denom()).Sign() != 0 {
+		precision++
+		pow.Mul(pow, ten)
+	}
+
+	s := r.FloatString(precision)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + a.String() + `"`), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface, numbers are accepted for passports written by earlier versions
+func (a *Amount) UnmarshalJSON(data []byte) (err error) {
+	data = bytes.Trim(data, `"`)
+	if string(data) == "null" || len(data) == 0 {
+		*a = Amount{}
+		return
+	}
+	*a, err = ParseAmount(string(data))
+	return
+}
@@ -0,0 +1,111 @@
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func bigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid integer " + s)
+	}
+	return v
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		value    *big.Int
+		decimals int
+		want     string
+	}{
+		{nil, 18, "0"},
+		{big.NewInt(0), 18, "0"},
+		{big.NewInt(1), 18, "0.000000000000000001"},
+		{bigInt("5000000000000000000"), 18, "5"},
+		{big.NewInt(-15), 1, "-1.5"},
+		{big.NewInt(1234), 0, "1234"},
+		// above 2^53, the value is not exact as float64
+		{bigInt("1152921504606846977"), 18, "1.152921504606846977"},
+		{bigInt("123456789012345678901234567"), 18, "123456789.012345678901234567"},
+	}
+
+	for _, tt := range tests {
+		a := NewAmount(tt.value, tt.decimals)
+		got := a.String()
+		if got != tt.want {
+			t.Errorf("NewAmount(%v, %d).String() = %q, want %q", tt.value, tt.decimals, got, tt.want)
+			continue
+		}
+
+		parsed, err := ParseAmount(got)
+		if err != nil {
+			t.Errorf("ParseAmount(%q): %v", got, err)
+			continue
+		}
+		if parsed.Cmp(a) != 0 {
+			t.Errorf("ParseAmount(%q) = %s, want %s", got, parsed, a)
+		}
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	a := NewAmount(bigInt("123456789012345678901234567"), 18)
+	b, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `"123456789.012345678901234567"`; got != want {
+		t.Errorf("json.Marshal = %s, want %s", got, want)
+	}
+
+	var decoded Amount
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Cmp(a) != 0 {
+		t.Errorf("json.Unmarshal(%s) = %s, want %s", b, decoded, a)
+	}
+}
+
+func TestAmountUnmarshalLegacyNumbers(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`1.5`, "1.5"},
+		{`0`, "0"},
+		{`1e3`, "1000"},
+		{`-0.25`, "-0.25"},
+		{`12345678901234567890.5`, "12345678901234567890.5"},
+		{`null`, "0"},
+		{`""`, "0"},
+	}
+
+	for _, tt := range tests {
+		var a Amount
+		if err := json.Unmarshal([]byte(tt.data), &a); err != nil {
+			t.Errorf("json.Unmarshal(%s): %v", tt.data, err)
+			continue
+		}
+		if got := a.String(); got != tt.want {
+			t.Errorf("json.Unmarshal(%s) = %s, want %s", tt.data, got, tt.want)
+		}
+	}
+
+	// numbers are decoded in a struct, the way passports written by earlier versions are read
+	var v struct {
+		IcoEthIn Amount `json:"ico_eth_in"`
+	}
+	if err := json.Unmarshal([]byte(`{"ico_eth_in": 1234.000000000000000001}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v.IcoEthIn.String(), "1234.000000000000000001"; got != want {
+		t.Errorf("json.Unmarshal of legacy number = %s, want %s", got, want)
+	}
+
+	if err := json.Unmarshal([]byte(`true`), new(Amount)); err == nil {
+		t.Error("json.Unmarshal(true) succeeded, want error")
+	}
+}
@@ -7,10 +7,52 @@ const (
 	ReceiptStatusSuccessful = uint64(1)
 	// OrderStateNull is order state for null order
 	OrderStateNull = uint8(0)
+	// OrderStateCreated is order state for created but not yet paid order
+	OrderStateCreated = uint8(1)
 	// OrderStatePaid is order state for paid order
 	OrderStatePaid = uint8(2)
+	// OrderStateFinalized is order state for order which payment is processed
+	OrderStateFinalized = uint8(3)
+	// OrderStateRefunding is order state for order which payment is refunded but not yet withdrawn
+	OrderStateRefunding = uint8(4)
+	// OrderStateRefunded is order state for order which refund is withdrawn
+	OrderStateRefunded = uint8(5)
+	// OrderStateCancelled is order state for cancelled order
+	OrderStateCancelled = uint8(6)
 )
 
+// CheckStatus is result of a check
+type CheckStatus string
+
+const (
+	// CheckPassed is status of passed check
+	CheckPassed CheckStatus = "Passed"
+	// CheckFailed is status of failed check
+	CheckFailed CheckStatus = "Failed"
+	// CheckInconclusive is status of check which lacks data or can't compute the result
+	CheckInconclusive CheckStatus = "Inconclusive"
+	// CheckSkipped is status of check which doesn't apply to the ICO or wasn't run
+	CheckSkipped CheckStatus = "Skipped"
+)
+
+var orderStateNames = map[uint8]string{
+	OrderStateNull:      "null",
+	OrderStateCreated:   "created",
+	OrderStatePaid:      "paid",
+	OrderStateFinalized: "finalized",
+	OrderStateRefunding: "refunding",
+	OrderStateRefunded:  "refunded",
+	OrderStateCancelled: "cancelled",
+}
+
+// OrderStateName returns name of the payment processor order state
+func OrderStateName(state uint8) string {
+	if name, ok := orderStateNames[state]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 // ICORatingData stores data fetched from ico rating website
 type ICORatingData struct {
 	CfrCurrency      string  `json:"cfr_currency"`
@@ -20,6 +62,10 @@ type ICORatingData struct {
 	IcoPriceCur      string  `json:"ico_price_cur"`
 	IcoPrice         float64 `json:"ico_price"`
 	IcoPriceAdjusted float64 `json:"ico_price_adjusted"`
+	SoftCap          float64 `json:"soft_cap,omitempty"`
+	SoftCapCurrency  string  `json:"soft_cap_currency,omitempty"`
+	HardCap          float64 `json:"hard_cap,omitempty"`
+	HardCapCurrency  string  `json:"hard_cap_currency,omitempty"`
 }
 
 // EtherScanAllTxns stores data fetched from etherscan for all token txns
@@ -127,31 +173,131 @@ type PoloniexData struct {
 
 // CalculatedData stores final analysed data for an ICO
 type CalculatedData struct {
-	TokensIssued     int64   `json:"tokens_issued"`
-	EfrToken         float64 `json:"efr_token"`
-	EthRateStart     float64 `json:"eth_rate_start"`
-	EthRateEnd       float64 `json:"eth_rate_end"`
-	EfrTokenAdjusted float64 `json:"efr_token_adjusted"`
-	TokenCheckResult struct {
-		FundsRaisedDiff         float64 `json:"funds_raised_diff"`
+	TokensIssued Amount `json:"tokens_issued"`
+	// TokenTotalSupply is totalSupply() of the token contract, TokensIssued is derived from the token distribution
+	TokenTotalSupply *Amount    `json:"token_total_supply,omitempty"`
+	Token            *TokenInfo `json:"token,omitempty"`
+	EfrToken         float64    `json:"efr_token"`
+	EthRateStart     float64    `json:"eth_rate_start"`
+	EthRateEnd       float64    `json:"eth_rate_end"`
+	EthRateSource    string     `json:"eth_rate_source,omitempty"`
+	EthRateSpread    float64    `json:"eth_rate_spread,omitempty"`
+	// ReportingCurrency is the currency claimed funds raised and ICO price are normalised to before comparison
+	ReportingCurrency string  `json:"reporting_currency,omitempty"`
+	CfrReporting      float64 `json:"cfr_reporting,omitempty"`
+	IcoPriceReporting float64 `json:"ico_price_reporting,omitempty"`
+	// IcoPriceAdjustedReporting is ICO price in ReportingCurrency adjusted by ETH rate change during ICO,
+	// ico_info.ico_price_adjusted is the same in ICO price currency
+	IcoPriceAdjustedReporting float64 `json:"ico_price_adjusted_reporting,omitempty"`
+	EfrTokenAdjusted          float64 `json:"efr_token_adjusted"`
+	TokenCheckResult          struct {
+		FundsRaisedResult
 		FundsRaisedAdjustedDiff float64 `json:"funds_raised_adjusted_diff"`
-		FundsRaisedCheck        string  `json:"funds_raised_check"`
 	} `json:"token_check_result"`
-	IcoEthIn             float64 `json:"ico_eth_in"`
-	IcoEthOut            int64   `json:"ico_eth_out"`
-	IcoEthTotal          int64   `json:"ico_eth_total"`
-	EfrIcoTx             float64 `json:"efr_ico_tx"`
-	EfrOwnerTxCurrency   string  `json:"efr_owner_tx_currency"`
-	IcoWalletCheckResult struct {
-		FundsRaisedDiff  float64 `json:"funds_raised_diff"`
-		FundsRaisedCheck string  `json:"funds_raised_check"`
-	} `json:"ico_wallet_check_result"`
-	Metrics struct {
-		DistributionDays              float64 `json:"distribution_days"`
-		DistributionStartFromIcoStart string  `json:"distribution_start_from_ico_start"`
-		DistributionEndFromIcoEnd     string  `json:"distribution_end_from_ico_end"`
-		FundsBalanceEth               float64 `json:"funds_balance_eth"`
+	IcoEthIn             Amount            `json:"ico_eth_in"`
+	IcoEthOut            Amount            `json:"ico_eth_out"`
+	IcoEthTotal          int64             `json:"ico_eth_total"`
+	EfrIcoTx             float64           `json:"efr_ico_tx"`
+	EfrIcoTxTimeWeighted float64           `json:"efr_ico_tx_time_weighted,omitempty"`
+	EfrOwnerTxCurrency   string            `json:"efr_owner_tx_currency"`
+	IcoWalletCheckResult FundsRaisedResult `json:"ico_wallet_check_result"`
+	Metrics              struct {
+		DistributionDays              float64             `json:"distribution_days"`
+		DistributionStartFromIcoStart string              `json:"distribution_start_from_ico_start"`
+		DistributionEndFromIcoEnd     string              `json:"distribution_end_from_ico_end"`
+		FundsBalanceEth               Amount              `json:"funds_balance_eth"`
+		Holders                       *HolderDistribution `json:"holders,omitempty"`
 	} `json:"metrics"`
+	Outflows *OutflowData `json:"outflows,omitempty"`
+	// CapCheckResult checks that funds raised on-chain are between soft and hard cap
+	CapCheckResult ComplianceCheck `json:"cap_check_result"`
+	// ContributionWindowCheckResult checks that contributions arrived within ICO start and end dates
+	ContributionWindowCheckResult ComplianceCheck `json:"contribution_window_check_result"`
+	// DistributionStartCheckResult checks that token distribution didn't start before ICO start date
+	DistributionStartCheckResult ComplianceCheck `json:"distribution_start_check_result"`
+	TrustScore                   *TrustScore     `json:"trust_score,omitempty"`
+	// Warnings are non-fatal problems found during the analysis
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// TrustScore stores 0-100 score combining checks and metrics of the analysis
+type TrustScore struct {
+	Score float64 `json:"score"`
+	// WeightsVersion is version of the weights configuration the score was computed with
+	WeightsVersion string        `json:"weights_version"`
+	Factors        []ScoreFactor `json:"factors"`
+}
+
+// ScoreFactor stores value of a single factor from 0 to 1 and its contribution to the score
+type ScoreFactor struct {
+	Name         string  `json:"name"`
+	Weight       float64 `json:"weight"`
+	Value        float64 `json:"value"`
+	Contribution float64 `json:"contribution"`
+	// Skipped factors lack data, their weight is spread over other factors
+	Skipped bool   `json:"skipped,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// FundsRaisedResult stores comparison of funds raised derived from on-chain data with claimed funds raised
+type FundsRaisedResult struct {
+	FundsRaisedDiff  float64     `json:"funds_raised_diff"`
+	FundsRaisedCheck CheckStatus `json:"funds_raised_check"`
+	Reason           string      `json:"funds_raised_check_reason,omitempty"`
+	// MaxShortfall is the threshold, the check fails when funds raised are lower than claimed by more than MaxShortfall
+	MaxShortfall float64 `json:"max_shortfall"`
+}
+
+// ComplianceCheck stores result of a compliance check with evidence it's based on
+type ComplianceCheck struct {
+	Result CheckStatus `json:"result"`
+	Reason string      `json:"reason,omitempty"`
+	// Thresholds are limits the data was compared with, dates are unix timestamps
+	Thresholds map[string]float64 `json:"thresholds,omitempty"`
+	Evidence   []string           `json:"evidence,omitempty"`
+}
+
+// TokenInfo stores metadata read from ERC20 token contract
+type TokenInfo struct {
+	Name     string `json:"name,omitempty"`
+	Symbol   string `json:"symbol,omitempty"`
+	Decimals int    `json:"decimals"`
+}
+
+// HolderDistribution stores token ownership concentration computed by replaying all token transfers
+type HolderDistribution struct {
+	Holders          int64   `json:"holders"`
+	UniqueRecipients int64   `json:"unique_recipients"`
+	TopHoldersCount  int     `json:"top_holders_count"`
+	TopHoldersShare  float64 `json:"top_holders_share"`
+	Gini             float64 `json:"gini"`
+	// IssuerShare is share of tokens held by the token issuing address and the owner
+	IssuerShare float64 `json:"issuer_share"`
+}
+
+// OutflowData stores ETH sent out of the fund address bucketed by destination type
+type OutflowData struct {
+	ToExchanges Amount `json:"to_exchanges"`
+	ToContracts Amount `json:"to_contracts"`
+	ToFreshEoas Amount `json:"to_fresh_eoas"`
+	ToOtherEoas Amount `json:"to_other_eoas"`
+	// Within30Days is ETH sent out within 30 days after ICO end date
+	Within30Days Amount `json:"within_30_days"`
+	// Destinations are the largest destinations with their own outflows (the second hop)
+	Destinations []OutflowDestination `json:"destinations,omitempty"`
+}
+
+// OutflowDestination stores ETH sent from the fund address to the destination and sent further by it
+type OutflowDestination struct {
+	Address       string `json:"address"`
+	Kind          string `json:"kind"`
+	Label         string `json:"label,omitempty"`
+	Eth           Amount `json:"eth"`
+	FirstTransfer string `json:"first_transfer"`
+	// ForwardedEth is ETH sent out by the destination
+	ForwardedEth Amount `json:"forwarded_eth"`
+	// ForwardedToExchanges is ETH sent by the destination to known exchange addresses
+	ForwardedToExchanges Amount `json:"forwarded_to_exchanges"`
 }
 
 // ICOAnalyzerData is data recieved from web app for ico analysis
@@ -172,6 +318,13 @@ type ICOAnalyzerData struct {
 	TxHash                 string  `json:"txHash"`
 	OrderID                int64   `json:"orderId"`
 	AccountAddress         string  `json:"accountAddress"`
+	// SoftCap and HardCap override caps published by ICO metadata source
+	SoftCap         float64 `json:"softCap,omitempty"`
+	SoftCapCurrency string  `json:"softCapCurrency,omitempty"`
+	HardCap         float64 `json:"hardCap,omitempty"`
+	HardCapCurrency string  `json:"hardCapCurrency,omitempty"`
+	// PreviousTxHash is hash of transaction which wrote the previous ICO data to the passport
+	PreviousTxHash string `json:"previousTxHash,omitempty"`
 }
 
 // ICOPassport contains complete ico passport data
@@ -180,3 +333,36 @@ type ICOPassport struct {
 	IcoInfo        ICORatingData   `json:"ico_info"`
 	CalculatedData CalculatedData  `json:"calculated_data"`
 }
+
+// PassportSchemaVersion is version of ICOPassport schema of reports kept in blob store
+const PassportSchemaVersion = 1
+
+// PassportReference is written to the passport instead of the full ICO passport kept in blob store
+type PassportReference struct {
+	// SchemaVersion is PassportSchemaVersion of the report
+	SchemaVersion int `json:"schema_version"`
+	// ContentHash is hash of the report, e.g. "sha256:9f86d0...", readers verify fetched reports against it
+	ContentHash string `json:"content_hash"`
+	// Storage names blob store of the report, "file" or "ipfs"
+	Storage string `json:"storage"`
+	// Key is key of the report in the blob store, CID for IPFS
+	Key     string          `json:"key"`
+	Summary PassportSummary `json:"summary"`
+}
+
+// PassportSummary is compact summary of ICO passport kept in blob store
+type PassportSummary struct {
+	IcoName                 string      `json:"ico_name"`
+	TokenContractAddress    string      `json:"token_contract_address"`
+	PreviousTxHash          string      `json:"previous_tx_hash,omitempty"`
+	ReportingCurrency       string      `json:"reporting_currency"`
+	CfrReporting            float64     `json:"cfr_reporting"`
+	EfrToken                float64     `json:"efr_token"`
+	EfrIcoTx                float64     `json:"efr_ico_tx"`
+	TokenCheck              CheckStatus `json:"token_check"`
+	IcoWalletCheck          CheckStatus `json:"ico_wallet_check"`
+	CapCheck                CheckStatus `json:"cap_check"`
+	ContributionWindowCheck CheckStatus `json:"contribution_window_check"`
+	DistributionStartCheck  CheckStatus `json:"distribution_start_check"`
+	TrustScore              *float64    `json:"trust_score,omitempty"`
+}